@@ -5,6 +5,7 @@ import (
 
 	"github.com/puppetlabs/pct/docs/md"
 	"github.com/puppetlabs/pct/pkg/docs"
+	"github.com/puppetlabs/pct/pkg/template_funcs"
 	"github.com/spf13/cobra"
 )
 
@@ -68,6 +69,19 @@ func CreateCommand() *cobra.Command {
 
 func preExecute(cmd *cobra.Command, args []string) {
 	docsApi.FindAndParse("content")
+	// Generated from the function registry so it always matches the binary
+	docsApi.ParsedDocsCache = append(docsApi.ParsedDocsCache, docs.MarkdownDoc{
+		Body: template_funcs.Markdown(),
+		FrontMatter: docs.DocsFrontMatter{
+			Title: docs.Title{
+				Short: "template-functions",
+				Long:  "Template Functions",
+			},
+			Description: "Functions available when writing PCT templates.",
+			Category:    "reference",
+			Tags:        []string{"templates", "functions"},
+		},
+	})
 }
 
 func validateArgCount(cmd *cobra.Command, args []string) error {
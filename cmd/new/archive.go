@@ -0,0 +1,126 @@
+package new
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/puppetlabs/pct/internal/pkg/pct"
+	"github.com/puppetlabs/pct/pkg/gzip"
+	"github.com/puppetlabs/pct/pkg/tar"
+	"github.com/puppetlabs/pct/pkg/zip"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+)
+
+// Formats --archive can write
+const (
+	archiveFormatTarGz = "tar.gz"
+	archiveFormatZip   = "zip"
+)
+
+// archiveFormat works out the format of an archive from its file name. Archives
+// written to stdout are always gzipped tarballs.
+func archiveFormat(path string) (string, error) {
+	switch {
+	case path == "-", strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		return archiveFormatTarGz, nil
+	case strings.HasSuffix(path, ".zip"):
+		return archiveFormatZip, nil
+	}
+	return "", fmt.Errorf("Unsupported archive '%s', expected a .tar.gz, .tgz or .zip file, or - for stdout", path)
+}
+
+// deployArchive deploys a template into memory, reading templates and
+// configuration from disk but writing nothing to it, then writes the deployed
+// content to an archive. Hooks are never run, as there is no directory on
+// disk to run them in.
+func deployArchive(api *pct.Pct, info pct.DeployInfo, archive string) ([]pct.DeployedFile, error) {
+	format, err := archiveFormat(archive)
+	if err != nil {
+		return nil, err
+	}
+	if info.DryRun {
+		return nil, fmt.Errorf("--dry-run cannot be used with --archive")
+	}
+	if info.TargetOutputDir != "" {
+		return nil, fmt.Errorf("--output cannot be used with --archive")
+	}
+
+	name := info.TargetName
+	if name == "" {
+		cwd, err := api.OsUtils.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		name = filepath.Base(cwd)
+	}
+
+	// Deploy to a directory that doesn't exist on disk, so nothing already there
+	// can conflict with the deployment
+	root := filepath.Join(os.TempDir(), fmt.Sprintf("pct-archive-%d", os.Getpid()), name)
+	mem := &afero.Afero{Fs: afero.NewMemMapFs()}
+	fs := afero.NewCopyOnWriteFs(afero.NewReadOnlyFs(api.AFS.Fs), mem.Fs)
+
+	inMemory := *api
+	inMemory.AFS = &afero.Afero{Fs: fs}
+	inMemory.IOFS = &afero.IOFS{Fs: fs}
+
+	info.TargetOutputDir = root
+	info.TargetName = name
+	if info.AllowHooks || len(info.TrustedHooks) > 0 {
+		log.Debug().Msg("Hooks are not run when deploying to an archive")
+	}
+	info.AllowHooks = false
+	info.TrustedHooks = nil
+
+	deployed, err := inMemory.Deploy(info)
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer = os.Stdout
+	if archive != "-" {
+		file, err := api.AFS.Create(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				log.Error().Msgf("Error closing file: %s\n", err)
+			}
+		}()
+		out = file
+	}
+
+	if err := writeArchive(mem, root, format, name, out); err != nil {
+		return nil, fmt.Errorf("Unable to write archive '%s': %v", archive, err)
+	}
+
+	// Report paths as they appear within the archive
+	for i, d := range deployed {
+		if rel, err := filepath.Rel(root, d.Path); err == nil {
+			deployed[i].Path = filepath.ToSlash(rel)
+		}
+	}
+	return deployed, nil
+}
+
+// writeArchive streams the contents of a directory into an archive of the
+// given format
+func writeArchive(afs *afero.Afero, dir string, format string, name string, out io.Writer) error {
+	if format == archiveFormatZip {
+		return (&zip.Zip{AFS: afs}).Write(out, dir)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError((&tar.Tar{AFS: afs}).Write(writer, dir)) //nolint:errcheck
+	}()
+
+	err := (&gzip.Gzip{AFS: afs}).Write(out, reader, name+".tar")
+	reader.CloseWithError(err) //nolint:errcheck
+	return err
+}
@@ -2,13 +2,16 @@ package new
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/puppetlabs/pct/internal/pkg/pct"
+	"github.com/puppetlabs/pct/pkg/exec_runner"
 	"github.com/puppetlabs/pct/pkg/telemetry"
 	"github.com/puppetlabs/pct/pkg/utils"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
@@ -24,6 +27,17 @@ var (
 	listTemplates           bool
 	targetName              string
 	targetOutput            string
+	dryRun                  bool
+	onConflict              string
+	replayManifest          string
+	valueFiles              []string
+	setValues               []string
+	interactive             bool
+	noPrompt                bool
+	allowHooks              bool
+	strict                  bool
+	noRootDetection         bool
+	archivePath             string
 	pctApi                  *pct.Pct
 	cachedTemplates         []pct.PuppetContentTemplate
 )
@@ -42,19 +56,45 @@ func CreateCommand() *cobra.Command {
 	// Configure PCT
 	fs := afero.NewOsFs() // configure afero to use real filesystem
 	pctApi = &pct.Pct{
-		OsUtils: &utils.OsUtil{},
-		Utils:   &utils.UtilsHelper{},
-		AFS:     &afero.Afero{Fs: fs},
-		IOFS:    &afero.IOFS{Fs: fs},
+		OsUtils:  &utils.OsUtil{},
+		Utils:    &utils.UtilsHelper{},
+		AFS:      &afero.Afero{Fs: fs},
+		IOFS:     &afero.IOFS{Fs: fs},
+		Prompter: &pct.Prompter{In: os.Stdin, Out: os.Stdout},
+		Exec:     &exec_runner.Exec{},
 	}
 
 	tmp.Flags().SortFlags = false
 
 	tmp.Flags().StringVarP(&targetName, "name", "n", "", "the name for the created output.")
 	tmp.Flags().StringVarP(&targetOutput, "output", "o", "", "location to place the generated output.")
+	tmp.Flags().BoolVar(&noRootDetection, "no-root-detection", false, "deploy item templates to the current directory rather than the root of the project it is within")
+
+	tmp.Flags().BoolVar(&dryRun, "dry-run", false, "report what would be deployed without writing any files")
+
+	tmp.Flags().StringVar(&onConflict, "on-conflict", pct.ConflictPolicyOverwrite, fmt.Sprintf("how to handle existing files with different content (%s)", strings.Join(pct.ConflictPolicies, ", ")))
+	err := tmp.RegisterFlagCompletionFunc("on-conflict", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return pct.ConflictPolicies, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+	})
+	cobra.CheckErr(err)
+
+	tmp.Flags().StringArrayVar(&valueFiles, "values", nil, "a YAML file of template values; can be repeated, later files take precedence")
+	tmp.Flags().StringArrayVar(&setValues, "set", nil, "set a template value, eg puppet_module.author=acme; can be repeated")
+
+	tmp.Flags().BoolVar(&interactive, "interactive", false, "prompt for each template value (the default when run in a terminal)")
+	tmp.Flags().BoolVar(&noPrompt, "no-prompt", false, "never prompt for template values")
+
+	tmp.Flags().StringVar(&archivePath, "archive", "", "write the generated content to a .tar.gz or .zip archive instead of a directory, or - for a .tar.gz on stdout")
+
+	tmp.Flags().BoolVar(&allowHooks, "allow-hooks", false, "run the commands the template declares as hooks")
+
+	tmp.Flags().BoolVar(&strict, "strict", false, "fail when a template uses a value that isn't set")
+
+	tmp.Flags().StringVar(&replayManifest, "replay", "", "regenerate content from the templates and values recorded in a manifest")
+	tmp.Flags().Lookup("replay").NoOptDefVal = pct.ManifestPath(".")
 
 	tmp.Flags().BoolVarP(&listTemplates, "list", "l", false, "list templates")
-	err := tmp.RegisterFlagCompletionFunc("list", flagCompletion)
+	err = tmp.RegisterFlagCompletionFunc("list", flagCompletion)
 	cobra.CheckErr(err)
 
 	tmp.Flags().StringVarP(&selectedTemplateInfo, "info", "i", "", "display the selected template's configuration and default values")
@@ -90,7 +130,7 @@ func preExecute(cmd *cobra.Command, args []string) error {
 
 func validateArgCount(cmd *cobra.Command, args []string) error {
 	// show available templates if user runs `pct new`
-	if len(args) == 0 && !listTemplates {
+	if len(args) == 0 && !listTemplates && replayManifest == "" {
 		listTemplates = true
 	}
 
@@ -172,6 +212,10 @@ func execute(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	if replayManifest != "" {
+		return replay(cmd)
+	}
+
 	if selectedTemplateInfo != "" {
 		matchingTemplates := pctApi.FilterFiles(cachedTemplates, func(f pct.PuppetContentTemplate) bool {
 			return fmt.Sprintf("%s/%s", f.Author, f.Id) == selectedTemplateInfo
@@ -212,18 +256,152 @@ func execute(cmd *cobra.Command, args []string) error {
 	appVersionString := cmd.Parent().Version
 	pdkInfo := getApplicationInfo(appVersionString)
 
-	deployed := pctApi.Deploy(pct.DeployInfo{
+	deployInfo := pct.DeployInfo{
 		SelectedTemplate: selectedTemplate,
 		TemplateDirPath:  selectedTemplateDirPath,
 		TargetOutputDir:  targetOutput,
 		TargetName:       targetName,
 		PdkInfo:          pdkInfo,
-	})
+		DryRun:           dryRun,
+		OnConflict:       onConflict,
+		ValueFiles:       valueFiles,
+		SetValues:        setValues,
+		AllowHooks:       allowHooks,
+		TrustedHooks:     viper.GetStringSlice("trusted_hooks"),
+		Strict:           strict,
+		NoRootDetection:  noRootDetection,
+	}
+
+	if archivePath == "-" {
+		// Keep stdout clear for the archive
+		log.Logger = log.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		pctApi.Prompter = &pct.Prompter{In: os.Stdin, Out: os.Stderr}
+	}
+
+	prompt, err := shouldPrompt()
+	if err != nil {
+		return err
+	}
+	if prompt {
+		deployInfo.Values, err = pctApi.PromptParameters(deployInfo)
+		if err != nil {
+			return err
+		}
+	}
+
+	if archivePath != "" {
+		return newArchive(deployInfo)
+	}
 
-	err := pctApi.FormatDeployment(deployed, format)
+	deployed, err := pctApi.Deploy(deployInfo)
+	if err != nil {
+		return reportFailedDeployment(deployed, err)
+	}
+
+	err = pctApi.FormatDeployment(deployed, format)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// reportFailedDeployment lists the files of a deployment that failed after they
+// were written, such as when a post_deploy hook fails, before returning its error
+func reportFailedDeployment(deployed []pct.DeployedFile, err error) error {
+	if len(deployed) > 0 {
+		if formatErr := pctApi.FormatDeployment(deployed, format); formatErr != nil {
+			log.Error().Msgf("Unable to list the deployed files: %v", formatErr)
+		}
+	}
+	return err
+}
+
+// newArchive deploys into an archive rather than the filesystem. When the
+// archive is written to stdout the deployed files are only logged, never
+// printed as json, so the archive isn't corrupted.
+func newArchive(deployInfo pct.DeployInfo) error {
+	outputFormat := format
+	if archivePath == "-" {
+		outputFormat = "table"
+	}
+
+	deployed, err := deployArchive(pctApi, deployInfo, archivePath)
+	if err != nil {
+		return err
+	}
+	return pctApi.FormatDeployment(deployed, outputFormat)
+}
+
+// shouldPrompt decides whether to ask for template values: always with
+// --interactive, never with --no-prompt, otherwise only when stdin is a terminal
+func shouldPrompt() (bool, error) {
+	if interactive && noPrompt {
+		return false, fmt.Errorf("--interactive and --no-prompt cannot be used together")
+	}
+	if interactive || noPrompt {
+		return interactive, nil
+	}
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false, nil
+	}
+	return stat.Mode()&os.ModeCharDevice != 0, nil
+}
+
+// replay redeploys every template recorded in a manifest with the values it was
+// originally deployed with
+func replay(cmd *cobra.Command) error {
+	manifest, err := pctApi.ReadManifest(replayManifest)
+	if err != nil {
+		return err
+	}
+
+	outputDir := targetOutput
+	if outputDir == "" {
+		// The manifest lives in the .pct directory of the content it describes
+		outputDir = filepath.Dir(filepath.Dir(replayManifest))
+	}
+	outputDir, err = filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+
+	pdkInfo := getApplicationInfo(cmd.Parent().Version)
+
+	var deployed []pct.DeployedFile
+	for _, entry := range manifest.Templates {
+		template := fmt.Sprintf("%s/%s", entry.Author, entry.Id)
+		if entry.Dependency {
+			log.Debug().Msgf("Not replaying '%s', it's deployed by the template depending on it", template)
+			continue
+		}
+		templateDirPath := filepath.Join(localTemplatePath, entry.Author, entry.Id, entry.Version)
+		if _, err := pctApi.Get(templateDirPath); err != nil {
+			return fmt.Errorf("Unable to replay '%s': version %s is not installed", template, entry.Version)
+		}
+		if entry.PctVersion != pdkInfo.Version {
+			log.Warn().Msgf("'%s' was deployed by pct %s, replaying with %s", template, entry.PctVersion, pdkInfo.Version)
+		}
+
+		log.Debug().Msgf("Replaying: %s %s", template, entry.Version)
+		d, err := pctApi.Deploy(pct.DeployInfo{
+			SelectedTemplate: template,
+			TemplateDirPath:  templateDirPath,
+			TargetOutputDir:  outputDir,
+			PdkInfo:          pdkInfo,
+			DryRun:           dryRun,
+			OnConflict:       onConflict,
+			Values:           entry.Values,
+			AllowHooks:       allowHooks,
+			TrustedHooks:     viper.GetStringSlice("trusted_hooks"),
+			Strict:           strict,
+		})
+		deployed = append(deployed, d...)
+		if err != nil {
+			return reportFailedDeployment(deployed, err)
+		}
+	}
+
+	return pctApi.FormatDeployment(deployed, format)
+}
@@ -1,12 +1,20 @@
 package new
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"io/ioutil"
+	"path/filepath"
 	"regexp"
 	"testing"
 
+	"github.com/puppetlabs/pct/internal/pkg/pct"
+	"github.com/puppetlabs/pct/pkg/mock"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
 )
 
 func nullFunction(cmd *cobra.Command, args []string) error {
@@ -74,3 +82,80 @@ func TestCreateCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestDeployArchive(t *testing.T) {
+	templateDir := "templates/author/id/0.1.0"
+	fs := afero.NewMemMapFs()
+	afs := &afero.Afero{Fs: fs}
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: project\n"), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "manifests", "init.pp"), []byte("class module {}"), 0640)                              //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "README.md"), []byte("# module"), 0640)                                                //nolint:errcheck
+
+	api := &pct.Pct{
+		OsUtils: &mock.OsUtil{WD: "/work/module"},
+		Utils:   &mock.UtilsHelper{TestDir: "/work"},
+		AFS:     afs,
+		IOFS:    &afero.IOFS{Fs: fs},
+	}
+	info := pct.DeployInfo{TemplateDirPath: templateDir, OnConflict: pct.ConflictPolicyOverwrite}
+
+	tests := []struct {
+		name    string
+		archive string
+		info    pct.DeployInfo
+		wantErr string
+	}{
+		{name: "tar.gz", archive: "/out/module.tar.gz"},
+		{name: "zip", archive: "/out/module.zip"},
+		{name: "unsupported", archive: "/out/module.rar", wantErr: "Unsupported archive '/out/module.rar'"},
+		{name: "dry run", archive: "/out/module.zip", info: pct.DeployInfo{DryRun: true}, wantErr: "--dry-run cannot be used with --archive"},
+		{name: "output", archive: "/out/module.zip", info: pct.DeployInfo{TargetOutputDir: "/out"}, wantErr: "--output cannot be used with --archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := info
+			i.DryRun = tt.info.DryRun
+			i.TargetOutputDir = tt.info.TargetOutputDir
+			deployed, err := deployArchive(api, i, tt.archive)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, deployed, pct.DeployedFile{Path: "module/manifests/init.pp", Action: pct.DeployActionCreate})
+
+			// nothing is deployed to disk
+			exists, _ := afs.Exists("/work/module/manifests/init.pp")
+			assert.False(t, exists)
+
+			content, err := afs.ReadFile(tt.archive)
+			assert.NoError(t, err)
+			names := make(map[string]string)
+			if tt.name == "zip" {
+				reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+				assert.NoError(t, err)
+				for _, f := range reader.File {
+					rc, _ := f.Open()
+					b, _ := ioutil.ReadAll(rc)
+					rc.Close()
+					names[f.Name] = string(b)
+				}
+			} else {
+				gz, err := gzip.NewReader(bytes.NewReader(content))
+				assert.NoError(t, err)
+				reader := tar.NewReader(gz)
+				for {
+					header, err := reader.Next()
+					if err != nil {
+						break
+					}
+					b, _ := ioutil.ReadAll(reader)
+					names[header.Name] = string(b)
+				}
+			}
+			assert.Equal(t, "class module {}", names["module/manifests/init.pp"])
+			assert.Equal(t, "# module", names["module/README.md"])
+			assert.Contains(t, names, "module/.pct/manifest.yml")
+		})
+	}
+}
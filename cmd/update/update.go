@@ -0,0 +1,265 @@
+package update
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/puppetlabs/pct/internal/pkg/pct"
+	"github.com/puppetlabs/pct/pkg/telemetry"
+	"github.com/puppetlabs/pct/pkg/utils"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	localTemplatePath string
+	format            string
+	selectedTemplate  string
+	fromVersion       string
+	toVersion         string
+	targetName        string
+	targetOutput      string
+	dryRun            bool
+	valueFiles        []string
+	setValues         []string
+	pctApi            *pct.Pct
+	cachedTemplates   []pct.PuppetContentTemplate
+)
+
+func CreateCommand() *cobra.Command {
+	tmp := &cobra.Command{
+		Use:   "update <template> [flags]",
+		Short: "Updates content generated from a template to a newer version of that template",
+		Long: `Updates content generated from a template to a newer version of that template.
+
+Both the version the content was generated from and the version being updated to
+are rendered with the same values: those recorded in the content's manifest when
+it was generated, along with any given with --values and --set. Changes between the two are then merged into
+the working files; where both the template and the working file changed the same
+lines, conflict markers are left in the file for you to resolve.`,
+		Args:              validateArgCount,
+		ValidArgsFunction: flagCompletion,
+		PreRunE:           preExecute,
+		RunE:              execute,
+	}
+
+	// Configure PCT
+	fs := afero.NewOsFs() // configure afero to use real filesystem
+	pctApi = &pct.Pct{
+		OsUtils: &utils.OsUtil{},
+		Utils:   &utils.UtilsHelper{},
+		AFS:     &afero.Afero{Fs: fs},
+		IOFS:    &afero.IOFS{Fs: fs},
+	}
+
+	tmp.Flags().SortFlags = false
+
+	tmp.Flags().StringVar(&fromVersion, "from", "", "the template version the content was generated from (default is the version recorded in the manifest)")
+	tmp.Flags().StringVar(&toVersion, "to", "", "the template version to update to (default is the newest installed version)")
+
+	tmp.Flags().StringVarP(&targetName, "name", "n", "", "the name the content was created with.")
+	tmp.Flags().StringVarP(&targetOutput, "output", "o", "", "location of the generated content.")
+
+	tmp.Flags().StringArrayVar(&valueFiles, "values", nil, "a YAML file of template values; can be repeated, later files take precedence")
+	tmp.Flags().StringArrayVar(&setValues, "set", nil, "set a template value, eg puppet_module.author=acme; can be repeated")
+
+	tmp.Flags().BoolVar(&dryRun, "dry-run", false, "report what would be updated without writing any files")
+
+	tmp.Flags().StringVar(&format, "format", "table", "display output in table or json format")
+	err := tmp.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"table", "json"}, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+	})
+	cobra.CheckErr(err)
+
+	tmp.Flags().StringVar(&localTemplatePath, "templatepath", "", "location of installed templates")
+	err = viper.BindPFlag("templatepath", tmp.Flags().Lookup("templatepath"))
+	cobra.CheckErr(err)
+
+	return tmp
+}
+
+func preExecute(cmd *cobra.Command, args []string) error {
+	defaultTemplatePath, err := utils.GetDefaultTemplatePath()
+	if err != nil {
+		return err
+	}
+
+	viper.SetDefault("templatepath", defaultTemplatePath)
+	localTemplatePath = viper.GetString("templatepath")
+
+	cachedTemplates = pctApi.List(localTemplatePath, "")
+
+	return nil
+}
+
+func validateArgCount(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Specify the template to update in AUTHOR/ID format")
+	}
+
+	if len(strings.Split(args[0], "/")) != 2 {
+		return fmt.Errorf("Selected template must be in AUTHOR/ID format")
+	}
+	selectedTemplate = args[0]
+
+	return nil
+}
+
+func flagCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if localTemplatePath == "" {
+		err := preExecute(cmd, args)
+		if err != nil {
+			log.Error().Msgf("Unable to set template path: %s", err.Error())
+			return nil, cobra.ShellCompDirectiveError
+		}
+	}
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, tmpl := range cachedTemplates {
+		namespacedTemplate := fmt.Sprintf("%s/%s", tmpl.Author, tmpl.Id)
+		if strings.HasPrefix(namespacedTemplate, toComplete) {
+			names = append(names, namespacedTemplate+"\t"+tmpl.Display)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
+
+func getApplicationInfo(appVersionString string) pct.PDKInfo {
+	info := strings.Split(appVersionString, "\n")[0]
+	appInfo := strings.Split(info, " ")
+
+	return pct.PDKInfo{
+		Version:   appInfo[1],
+		Commit:    appInfo[2],
+		BuildDate: appInfo[3],
+	}
+}
+
+// templateVersionDir returns the installed directory of a specific version of
+// the selected template
+func templateVersionDir(version string) (string, error) {
+	dir := filepath.Join(localTemplatePath, filepath.FromSlash(selectedTemplate), version)
+	if _, err := pctApi.Get(dir); err != nil {
+		return "", fmt.Errorf("Couldn't find version '%s' of '%s' installed at '%s'", version, selectedTemplate, localTemplatePath)
+	}
+	return dir, nil
+}
+
+// contentDir returns the directory of the content being updated: the output
+// directory if one was given, otherwise the root of the project the working
+// directory is within
+func contentDir() string {
+	if targetOutput != "" {
+		return targetOutput
+	}
+	cwd, _ := pctApi.OsUtils.Getwd()
+	return pctApi.FindProjectRoot(cwd)
+}
+
+// manifestEntry looks up the deployment of the selected template recorded in
+// the manifest of the content in outputDir
+func manifestEntry(outputDir string) (pct.ManifestEntry, error) {
+	manifest, err := pctApi.ReadManifest(pct.ManifestPath(outputDir))
+	if err != nil {
+		return pct.ManifestEntry{}, fmt.Errorf("Specify the template version the content was generated from with --from: %v", err)
+	}
+
+	namespace := strings.Split(selectedTemplate, "/")
+	entry, found := manifest.FindEntry(namespace[0], namespace[1])
+	if !found {
+		return pct.ManifestEntry{}, fmt.Errorf("'%s' is not recorded in the manifest; specify the version it was generated from with --from", selectedTemplate)
+	}
+
+	return entry, nil
+}
+
+func execute(cmd *cobra.Command, args []string) error {
+	span := telemetry.GetSpanFromContext(cmd.Context())
+	telemetry.AddStringSpanAttribute(span, "template", selectedTemplate)
+
+	log.Trace().Msgf("Template path: %v", localTemplatePath)
+	log.Trace().Msgf("Selected template: %v", selectedTemplate)
+
+	// Both versions are rendered with the values the content was generated with,
+	// so only changes made by the template are merged
+	outputDir := contentDir()
+	var recordedValues map[string]interface{}
+	entry, err := manifestEntry(outputDir)
+	if err == nil {
+		recordedValues = entry.Values
+		if fromVersion == "" {
+			fromVersion = entry.Version
+		}
+	} else if fromVersion == "" {
+		return err
+	} else {
+		log.Debug().Msgf("No manifest entry: %v", err)
+		log.Warn().Msgf("No values were recorded for '%s'; rendering with the current configuration", selectedTemplate)
+	}
+
+	if toVersion == "" {
+		matchingTemplates := pctApi.FilterFiles(cachedTemplates, func(f pct.PuppetContentTemplate) bool {
+			return fmt.Sprintf("%s/%s", f.Author, f.Id) == selectedTemplate
+		})
+		if len(matchingTemplates) != 1 {
+			return fmt.Errorf("Couldn't find an installed template that matches '%s'", selectedTemplate)
+		}
+		toVersion = matchingTemplates[0].Version
+	}
+
+	previousTemplateDirPath, err := templateVersionDir(fromVersion)
+	if err != nil {
+		return err
+	}
+	templateDirPath, err := templateVersionDir(toVersion)
+	if err != nil {
+		return err
+	}
+
+	// The content is updated where its manifest was found. Without --output the
+	// name can't place the content, so it only sets the name it renders with.
+	info := pct.DeployInfo{
+		SelectedTemplate: selectedTemplate,
+		TemplateDirPath:  templateDirPath,
+		TargetOutputDir:  outputDir,
+		TargetName:       targetName,
+		PdkInfo:          getApplicationInfo(cmd.Parent().Version),
+		DryRun:           dryRun,
+		ValueFiles:       valueFiles,
+		SetValues:        setValues,
+		RecordedValues:   recordedValues,
+	}
+	if targetOutput == "" && targetName != "" {
+		info.TargetName = ""
+		info.Values = map[string]interface{}{"pct_name": targetName}
+	}
+
+	updated, err := pctApi.Update(pct.UpdateInfo{
+		DeployInfo:              info,
+		PreviousTemplateDirPath: previousTemplateDirPath,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pctApi.FormatDeployment(updated, format)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range updated {
+		if u.Action == pct.DeployActionConflict && !dryRun {
+			log.Warn().Msg("Some files contain conflict markers which must be resolved")
+			break
+		}
+	}
+
+	return nil
+}
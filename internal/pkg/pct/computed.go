@@ -0,0 +1,169 @@
+package pct
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/puppetlabs/pct/pkg/template_funcs"
+)
+
+// computedValue is an entry of a template's computed section, parsed along
+// with the values its expression refers to
+type computedValue struct {
+	name       string
+	tmpl       *template.Template
+	references []string
+}
+
+// ValidateComputed checks that every expression in a template's computed
+// section parses, with the template's delimiters, and that computed values do
+// not depend on each other in a cycle
+func ValidateComputed(tmpl PuppetContentTemplateInfo) error {
+	_, err := orderComputed(tmpl.Computed, tmpl.Delimiters)
+	return err
+}
+
+// computeValues evaluates a template's computed values with the merged values
+// and sets each result, as a string, replacing any value of the same name. A
+// computed value may use others; each is evaluated after those it uses. When
+// strict, an expression using a value that isn't set is an error, as it is in
+// template files.
+func computeValues(tmpl PuppetContentTemplateInfo, config map[string]interface{}, strict bool) error {
+	ordered, err := orderComputed(tmpl.Computed, tmpl.Delimiters)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range ordered {
+		if strict {
+			c.tmpl.Option("missingkey=error")
+		}
+		var out strings.Builder
+		if err := c.tmpl.Execute(&out, config); err != nil {
+			return fmt.Errorf("Unable to compute '%s': %v", c.name, err)
+		}
+		setValue(config, c.name, out.String())
+	}
+	return nil
+}
+
+// orderComputed parses a template's computed values with its delimiters and
+// sorts them so that each comes after every other computed value it refers to.
+// Computed values may be nested, eg puppet_module.summary.
+func orderComputed(computed map[string]interface{}, delimiters []string) ([]computedValue, error) {
+	flattened := make(map[string]interface{})
+	flattenValues("", computed, flattened)
+
+	names := make([]string, 0, len(flattened))
+	values := make(map[string]computedValue, len(flattened))
+	for name, expression := range flattened {
+		name = strings.ToLower(name)
+		tmpl, err := template.New(name).Delims(delims(delimiters)).Funcs(template_funcs.FuncMap()).Parse(fmt.Sprint(expression))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse the computed value '%s': %v", name, err)
+		}
+		names = append(names, name)
+		values[name] = computedValue{name: name, tmpl: tmpl, references: fieldReferences(tmpl.Tree.Root)}
+		allowOptionalValues(tmpl)
+	}
+	sort.Strings(names)
+
+	var ordered []computedValue
+	done := make(map[string]bool)
+	var visit func(name string, stack []string) error
+	visit = func(name string, stack []string) error {
+		for i, s := range stack {
+			if s == name {
+				return fmt.Errorf("Computed values depend on each other in a cycle: %s -> %s", strings.Join(stack[i:], " -> "), name)
+			}
+		}
+		if done[name] {
+			return nil
+		}
+
+		stack = append(stack, name)
+		for _, other := range names {
+			if other != name && refersTo(values[name].references, other) {
+				if err := visit(other, stack); err != nil {
+					return err
+				}
+			}
+		}
+		done[name] = true
+		ordered = append(ordered, values[name])
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// refersTo reports whether any of the dotted references is to the named value,
+// within it or to a map containing it
+func refersTo(references []string, name string) bool {
+	for _, r := range references {
+		if r == name || strings.HasPrefix(r, name+".") || strings.HasPrefix(name, r+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldReferences returns the dotted path of every value a parsed expression
+// refers to, eg .puppet_module.author or $.pct_name
+func fieldReferences(node parse.Node) []string {
+	var references []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			references = append(references, strings.ToLower(strings.Join(n.Ident, ".")))
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				references = append(references, strings.ToLower(strings.Join(n.Ident[1:], ".")))
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(&n.BranchNode)
+		case *parse.RangeNode:
+			walk(&n.BranchNode)
+		case *parse.WithNode:
+			walk(&n.BranchNode)
+		case *parse.BranchNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(node)
+	return references
+}
@@ -0,0 +1,107 @@
+package pct
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Policies for handling a template file whose target already exists with
+// different content
+const (
+	ConflictPolicySkip      = "skip"
+	ConflictPolicyOverwrite = "overwrite"
+	ConflictPolicyBackup    = "backup"
+	ConflictPolicyFail      = "fail"
+	ConflictPolicyPrompt    = "prompt"
+)
+
+// BackupFileSuffix is appended to the name of a file backed up before being
+// overwritten
+const BackupFileSuffix = ".pct-bak"
+
+// ConflictPolicies lists every valid conflict policy
+var ConflictPolicies = []string{
+	ConflictPolicySkip,
+	ConflictPolicyOverwrite,
+	ConflictPolicyBackup,
+	ConflictPolicyFail,
+	ConflictPolicyPrompt,
+}
+
+func validateConflictPolicy(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	for _, p := range ConflictPolicies {
+		if p == policy {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown conflict policy '%s', expected one of: %s", policy, strings.Join(ConflictPolicies, ", "))
+}
+
+// resolveConflict decides what to do with a target file that already exists
+// with different content, returning the deployment action to take. An empty
+// policy keeps the historic behaviour of overwriting the file.
+func (p *Pct) resolveConflict(info DeployInfo, targetFile string) (string, error) {
+	switch info.OnConflict {
+	case ConflictPolicySkip:
+		return DeployActionSkip, nil
+	case ConflictPolicyBackup:
+		return DeployActionBackup, nil
+	case ConflictPolicyFail:
+		return DeployActionConflict, nil
+	case ConflictPolicyPrompt:
+		if info.DryRun {
+			return DeployActionConflict, nil
+		}
+		return p.promptConflict(targetFile)
+	}
+	return DeployActionOverwrite, nil
+}
+
+func (p *Pct) promptConflict(targetFile string) (string, error) {
+	if p.Prompter == nil {
+		return "", fmt.Errorf("Unable to prompt for how to handle existing file '%s'", targetFile)
+	}
+
+	question := fmt.Sprintf("'%s' already exists. [o]verwrite, [s]kip, [b]ackup and overwrite, or [a]bort?", targetFile)
+	for {
+		answer, err := p.Prompter.Ask(question)
+		if err != nil {
+			return "", fmt.Errorf("Unable to read answer for '%s': %v", targetFile, err)
+		}
+
+		switch strings.ToLower(answer) {
+		case "o", "overwrite":
+			return DeployActionOverwrite, nil
+		case "s", "skip":
+			return DeployActionSkip, nil
+		case "b", "backup":
+			return DeployActionBackup, nil
+		case "a", "abort":
+			return "", fmt.Errorf("Deployment aborted at '%s'", targetFile)
+		}
+		log.Warn().Msgf("Unrecognised answer '%s'", answer)
+	}
+}
+
+// backupFile copies an existing target file alongside itself with the
+// BackupFileSuffix, replacing any previous backup
+func (p *Pct) backupFile(targetFile string) error {
+	stat, err := p.AFS.Stat(targetFile)
+	if err != nil {
+		return err
+	}
+
+	content, err := p.AFS.ReadFile(targetFile)
+	if err != nil {
+		return err
+	}
+
+	backupFile := targetFile + BackupFileSuffix
+	log.Debug().Msgf("Backing up '%s' to '%s'", targetFile, backupFile)
+	return p.AFS.WriteFile(backupFile, content, stat.Mode())
+}
@@ -0,0 +1,52 @@
+package pct
+
+import (
+	"fmt"
+)
+
+// ValidateDelimiters checks that the delimiters a template sets, for all of its
+// files or for those matching an entry of its files section, are each a left
+// and right delimiter
+func ValidateDelimiters(tmpl PuppetContentTemplateInfo) error {
+	if err := validateDelimiterPair(tmpl.Delimiters); err != nil {
+		return err
+	}
+	for _, f := range tmpl.Files {
+		if err := validateDelimiterPair(f.Delimiters); err != nil {
+			return fmt.Errorf("%v for '%s'", err, f.Glob)
+		}
+	}
+	return nil
+}
+
+func validateDelimiterPair(delimiters []string) error {
+	if delimiters == nil {
+		return nil
+	}
+	if len(delimiters) != 2 || delimiters[0] == "" || delimiters[1] == "" {
+		return fmt.Errorf("Delimiters must be a left and a right delimiter, eg ['[[', ']]'], not %q", delimiters)
+	}
+	return nil
+}
+
+// fileDelimiters returns the delimiters a content file is parsed with: those of
+// the last matching entry in the template's files section, otherwise the
+// template's own. Nil means the default {{ and }}.
+func fileDelimiters(tmpl PuppetContentTemplateInfo, rel string) []string {
+	delimiters := tmpl.Delimiters
+	for _, f := range tmpl.Files {
+		if f.Delimiters != nil && matchesContentGlob(f.Glob, rel) {
+			delimiters = f.Delimiters
+		}
+	}
+	return delimiters
+}
+
+// delims returns delimiters as the arguments to template.Delims, where empty
+// strings select the defaults
+func delims(delimiters []string) (string, string) {
+	if len(delimiters) != 2 {
+		return "", ""
+	}
+	return delimiters[0], delimiters[1]
+}
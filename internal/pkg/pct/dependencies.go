@@ -0,0 +1,154 @@
+package pct
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/rs/zerolog/log"
+)
+
+// TemplateDependency is another installed template deployed into the same
+// target before the template that depends on it. Template is in author/id
+// form and Version is an optional constraint such as ">= 1.0, < 2.0"; the
+// newest installed version satisfying it is used. Values are passed to the
+// dependency, and strings within them are rendered with the dependent
+// template's values, eg "{{ .ci_provider }}".
+type TemplateDependency struct {
+	Template string                 `mapstructure:"template"`
+	Version  string                 `mapstructure:"version"`
+	Values   map[string]interface{} `mapstructure:"values"`
+}
+
+// resolveDependencies returns the deployments needed to deploy a template
+// along with everything it depends on, in the order they should be deployed:
+// each template's dependencies, depth first, before the template itself. A
+// template depended on more than once is only deployed the first time.
+func (p *Pct) resolveDependencies(info DeployInfo, stack []string, seen map[string]bool) ([]DeployInfo, error) {
+	plan, err := p.prepareDeployment(info)
+	if err != nil {
+		return nil, err
+	}
+	resolved, tmpl, config := plan.info, plan.tmpl, plan.config
+
+	name := fmt.Sprintf("%s/%s", tmpl.Template.Author, tmpl.Template.Id)
+	for _, s := range stack {
+		if s == name {
+			return nil, fmt.Errorf("Template dependency cycle detected: %s -> %s", strings.Join(stack, " -> "), name)
+		}
+	}
+	if seen[name] {
+		return nil, nil
+	}
+	stack = append(stack, name)
+
+	var chain []DeployInfo
+	for _, dependency := range tmpl.Dependencies {
+		dependencyDir, err := p.findDependency(info.TemplateDirPath, dependency)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to resolve the dependencies of '%s': %v", name, err)
+		}
+
+		values, err := dependencyValues(dependency, config)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to resolve the dependencies of '%s': %v", name, err)
+		}
+
+		dependencyInfo := resolved
+		dependencyInfo.SelectedTemplate = dependency.Template
+		dependencyInfo.TemplateDirPath = dependencyDir
+		dependencyInfo.Values = values
+		dependencyInfo.targetResolved = true
+
+		log.Debug().Msgf("'%s' depends on '%s' from %s", name, dependency.Template, dependencyDir)
+		dependencies, err := p.resolveDependencies(dependencyInfo, stack, seen)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, dependencies...)
+	}
+
+	seen[name] = true
+	return append(chain, info), nil
+}
+
+// findDependency returns the directory of the newest installed version of a
+// dependency that satisfies its version constraint. Dependencies are installed
+// alongside the template depending on them, in author/id/version directories
+// under the same template path.
+func (p *Pct) findDependency(templateDirPath string, dependency TemplateDependency) (string, error) {
+	parts := strings.Split(dependency.Template, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("dependency '%s' must be in AUTHOR/ID format", dependency.Template)
+	}
+
+	var constraint version.Constraints
+	if dependency.Version != "" {
+		var err error
+		constraint, err = version.NewConstraint(dependency.Version)
+		if err != nil {
+			return "", fmt.Errorf("invalid version constraint '%s' for '%s': %v", dependency.Version, dependency.Template, err)
+		}
+	}
+
+	templatePath := filepath.Dir(filepath.Dir(filepath.Dir(templateDirPath)))
+	dependencyPath := filepath.Join(templatePath, parts[0], parts[1])
+	entries, err := p.AFS.ReadDir(dependencyPath)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not installed", dependency.Template)
+	}
+
+	var newest *version.Version
+	var newestDir string
+	var installed []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		v, err := version.NewVersion(entry.Name())
+		if err != nil {
+			continue
+		}
+		if exists, _ := p.AFS.Exists(filepath.Join(dependencyPath, entry.Name(), TemplateConfigFileName)); !exists {
+			continue
+		}
+		installed = append(installed, entry.Name())
+		if constraint != nil && !constraint.Check(v) {
+			continue
+		}
+		if newest == nil || v.GreaterThan(newest) {
+			newest = v
+			newestDir = filepath.Join(dependencyPath, entry.Name())
+		}
+	}
+
+	if len(installed) == 0 {
+		return "", fmt.Errorf("'%s' is not installed", dependency.Template)
+	}
+	if newest == nil {
+		return "", fmt.Errorf("no installed version of '%s' satisfies '%s' (installed: %s)", dependency.Template, dependency.Version, strings.Join(installed, ", "))
+	}
+	return newestDir, nil
+}
+
+// dependencyValues renders the values a template passes to one of its
+// dependencies. Strings containing template actions are rendered with the
+// dependent template's values and then typed like values given with --set.
+func dependencyValues(dependency TemplateDependency, config map[string]interface{}) (map[string]interface{}, error) {
+	flattened := make(map[string]interface{})
+	flattenValues("", dependency.Values, flattened)
+
+	values := make(map[string]interface{})
+	for key, value := range flattened {
+		if s, ok := value.(string); ok && strings.Contains(s, "{{") {
+			rendered, err := renderString(s, config)
+			if err != nil {
+				return nil, fmt.Errorf("unable to render value '%s' for '%s': %v", key, dependency.Template, err)
+			}
+			value = ParseValue(rendered)
+		}
+		setValue(values, key, value)
+	}
+	return values, nil
+}
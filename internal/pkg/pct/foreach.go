@@ -0,0 +1,90 @@
+package pct
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ForeachItemName is the value a file expanded with foreach is rendered with,
+// bound to each entry of the list in turn
+const ForeachItemName = "item"
+
+// frontMatter holds the settings a template file can declare for itself in a
+// YAML block at its start, delimited by lines of ---
+type frontMatter struct {
+	Foreach string `yaml:"foreach"`
+}
+
+var frontMatterPattern = regexp.MustCompile(`(?s)\A---\r?\n(.*?)\r?\n---(?:\r?\n|\z)`)
+
+// splitFrontMatter separates any front matter from the rest of a template
+// file. A leading block is only front matter when it holds nothing but known
+// settings, so files that simply start with a YAML document are left alone.
+func splitFrontMatter(content []byte) (frontMatter, []byte) {
+	var matter frontMatter
+
+	match := frontMatterPattern.FindSubmatchIndex(content)
+	if match == nil {
+		return matter, content
+	}
+	if err := yaml.UnmarshalStrict(content[match[2]:match[3]], &matter); err != nil || matter == (frontMatter{}) {
+		return frontMatter{}, content
+	}
+	return matter, content[match[1]:]
+}
+
+// contentForeach returns the name of the list value a content file is
+// expanded over: the foreach of its front matter, otherwise that of the last
+// matching entry in the template's files section
+func (p *Pct) contentForeach(files []TemplateFileConfig, rel string, templateFile PuppetContentTemplateFileInfo) (string, error) {
+	foreach := ""
+	for _, f := range files {
+		if f.Foreach != "" && matchesContentGlob(f.Glob, rel) {
+			foreach = f.Foreach
+		}
+	}
+
+	if templateFile.IsTemplate {
+		content, err := p.AFS.ReadFile(templateFile.TemplatePath)
+		if err != nil {
+			return "", err
+		}
+		if matter, _ := splitFrontMatter(content); matter.Foreach != "" {
+			foreach = matter.Foreach
+		}
+	}
+	return foreach, nil
+}
+
+// foreachItems returns the entries of the list a file is expanded over. A
+// missing value expands to nothing.
+func foreachItems(name string, config map[string]interface{}) ([]interface{}, error) {
+	value, ok := lookupValue(config, name)
+	if !ok || value == nil {
+		return nil, nil
+	}
+
+	list := reflect.ValueOf(value)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, fmt.Errorf("The foreach value '%s' must be a list, not %T", name, value)
+	}
+	items := make([]interface{}, list.Len())
+	for i := range items {
+		items[i] = list.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// itemValues returns the values a file expanded with foreach is rendered with:
+// the merged values, with the item bound
+func itemValues(config map[string]interface{}, item interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(config)+1)
+	for k, v := range config {
+		values[k] = v
+	}
+	values[ForeachItemName] = item
+	return values
+}
@@ -0,0 +1,178 @@
+package pct
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// gitValues returns the user's git identity and details of the repository
+// content is deployed into, for templates to use as git.user.name,
+// git.user.email, git.origin_url, git.branch and git.root. The repository is
+// found from the target directory, otherwise the working directory. Git's
+// configuration files are read directly, so git doesn't need to be installed.
+// Without a configured identity the user name falls back to the OS user, and
+// values that can't be found are empty.
+func (p *Pct) gitValues(targetDir string) map[string]interface{} {
+	config := make(map[string]string)
+	if home, err := p.Utils.Dir(); err == nil && home != "" {
+		p.readGitConfig(filepath.Join(home, ".config", "git", "config"), config)
+		p.readGitConfig(filepath.Join(home, ".gitconfig"), config)
+	}
+
+	root, gitDir := p.findGitRepository(targetDir)
+	if root == "" {
+		cwd, _ := p.OsUtils.Getwd()
+		root, gitDir = p.findGitRepository(cwd)
+	}
+
+	branch := ""
+	if gitDir != "" {
+		p.readGitConfig(filepath.Join(p.gitCommonDir(gitDir), "config"), config)
+		if head, err := p.AFS.ReadFile(filepath.Join(gitDir, "HEAD")); err == nil {
+			// A detached HEAD holds a commit rather than a branch
+			branch = strings.TrimPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+			if branch == strings.TrimSpace(string(head)) {
+				branch = ""
+			}
+		}
+	}
+
+	name := config["user.name"]
+	if name == "" {
+		name = p.getCurrentUser()
+	}
+
+	return map[string]interface{}{
+		"git": map[string]interface{}{
+			"user": map[string]interface{}{
+				"name":  name,
+				"email": config["user.email"],
+			},
+			"origin_url": config["remote.origin.url"],
+			"branch":     branch,
+			"root":       root,
+		},
+	}
+}
+
+// findGitRepository returns the root of the git repository dir is within and
+// its git directory, or empty strings when it isn't in one. The .git of a
+// worktree or submodule is a file pointing to its git directory.
+func (p *Pct) findGitRepository(dir string) (root string, gitDir string) {
+	if dir == "" {
+		return "", ""
+	}
+
+	for current := filepath.Clean(dir); ; current = filepath.Dir(current) {
+		dotGit := filepath.Join(current, ".git")
+		if isDir, _ := p.AFS.IsDir(dotGit); isDir {
+			return current, dotGit
+		}
+		if content, err := p.AFS.ReadFile(dotGit); err == nil {
+			if target := strings.TrimSpace(string(content)); strings.HasPrefix(target, "gitdir:") {
+				target = filepath.FromSlash(strings.TrimSpace(strings.TrimPrefix(target, "gitdir:")))
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(current, target)
+				}
+				return current, target
+			}
+		}
+		if filepath.Dir(current) == current {
+			return "", ""
+		}
+	}
+}
+
+// gitCommonDir returns the directory holding the configuration of a git
+// directory, which for a worktree is that of the repository it belongs to
+func (p *Pct) gitCommonDir(gitDir string) string {
+	content, err := p.AFS.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	commonDir := filepath.FromSlash(strings.TrimSpace(string(content)))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	return commonDir
+}
+
+// readGitConfig adds the settings of a git configuration file to config, keyed
+// by their section, any subsection and name, eg user.name or
+// remote.origin.url. Settings read later override earlier ones, as with git.
+// Missing files are ignored.
+func (p *Pct) readGitConfig(path string, config map[string]string) {
+	file, err := p.AFS.Open(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error().Msgf("Error closing file: %s", err)
+		}
+	}()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			end := strings.LastIndex(line, "]")
+			if end < 0 {
+				continue
+			}
+			name, subsection, found := strings.Cut(line[1:end], " ")
+			section = strings.ToLower(strings.TrimSpace(name))
+			if found {
+				section += "." + strings.Trim(strings.TrimSpace(subsection), `"`)
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			// A name without a value is a boolean that's set
+			value = "true"
+		}
+		config[section+"."+strings.ToLower(strings.TrimSpace(key))] = gitConfigValue(value)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Debug().Msgf("Unable to read git configuration '%s': %v", path, err)
+	}
+}
+
+// gitConfigValue unquotes a value from a git configuration file and removes
+// any comment following it
+func gitConfigValue(raw string) string {
+	var value strings.Builder
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			default:
+				value.WriteByte(raw[i])
+			}
+		case c == '"':
+			quoted = !quoted
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(value.String())
+}
@@ -0,0 +1,206 @@
+package pct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/puppetlabs/pct/pkg/template_funcs"
+	"github.com/puppetlabs/pct/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// shellQuoteFunc is the template function values in hook commands are quoted with
+const shellQuoteFunc = "shellquote"
+
+// DefaultHookTimeout is how long a hook may run when a template does not set
+// its own timeout
+const DefaultHookTimeout = 10 * time.Minute
+
+// TemplateHooks are shell commands a template runs in the target directory
+// before any files are deployed and after they all have been. Each command is
+// rendered with the deployment's values, each of which is quoted as a single
+// shell argument. Timeout applies to each command and is a duration such as 90s
+// or 5m.
+type TemplateHooks struct {
+	PreDeploy  []string `mapstructure:"pre_deploy"`
+	PostDeploy []string `mapstructure:"post_deploy"`
+	Timeout    string   `mapstructure:"timeout"`
+}
+
+// renderedHooks holds a template's hooks ready to be run
+type renderedHooks struct {
+	preDeploy  []string
+	postDeploy []string
+	timeout    time.Duration
+}
+
+// renderHooks renders each of a template's hook commands with the merged values
+func renderHooks(hooks TemplateHooks, config map[string]interface{}) (renderedHooks, error) {
+	rendered := renderedHooks{timeout: DefaultHookTimeout}
+	if hooks.Timeout != "" {
+		timeout, err := time.ParseDuration(hooks.Timeout)
+		if err != nil {
+			return rendered, fmt.Errorf("Invalid hooks timeout '%s': %v", hooks.Timeout, err)
+		}
+		rendered.timeout = timeout
+	}
+
+	var err error
+	if rendered.preDeploy, err = renderCommands(hooks.PreDeploy, config); err != nil {
+		return rendered, err
+	}
+	if rendered.postDeploy, err = renderCommands(hooks.PostDeploy, config); err != nil {
+		return rendered, err
+	}
+	return rendered, nil
+}
+
+// renderCommands renders hook commands with the merged values. Everything a
+// command outputs from the values is passed through shellquote, so a value
+// can't break out of the argument it's used as and run commands of its own.
+func renderCommands(commands []string, config map[string]interface{}) ([]string, error) {
+	var rendered []string
+	for _, command := range commands {
+		tmpl, err := template.New("hook").Funcs(template_funcs.FuncMap()).Parse(command)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to render hook '%s': %v", command, err)
+		}
+		quoteActions(tmpl.Tree.Root)
+
+		var out strings.Builder
+		if err := tmpl.Execute(&out, config); err != nil {
+			return nil, fmt.Errorf("Unable to render hook '%s': %v", command, err)
+		}
+		rendered = append(rendered, out.String())
+	}
+	return rendered, nil
+}
+
+// quoteActions pipes every action of a parsed command that outputs a value
+// into shellquote, unless it already ends with it
+func quoteActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			quoteActions(child)
+		}
+	case *parse.ActionNode:
+		// Declaring or assigning a variable outputs nothing
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && ident.Ident == shellQuoteFunc {
+			return
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(shellQuoteFunc).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.RangeNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.WithNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	}
+}
+
+// HooksDigest identifies a template's hooks as written, so a user can trust
+// them to run without --allow-hooks. The digest covers the template's author
+// and id along with every command and the timeout, so it changes whenever the
+// hooks do and can't be claimed by a template with different hooks.
+func HooksDigest(tmpl PuppetContentTemplateInfo) string {
+	hooks, _ := json.Marshal(struct {
+		Author string
+		Id     string
+		Hooks  TemplateHooks
+	}{tmpl.Template.Author, tmpl.Template.Id, tmpl.Hooks})
+	sum := sha256.Sum256(hooks)
+	return hex.EncodeToString(sum[:])
+}
+
+// hooksAllowed reports whether a deployment may run its template's hooks: only
+// when asked to explicitly, or when the user trusts these exact hooks
+func hooksAllowed(plan deploymentPlan) bool {
+	return plan.info.AllowHooks || utils.Contains(plan.info.TrustedHooks, HooksDigest(plan.tmpl))
+}
+
+// runHooks runs the commands of one of a deployment's hook phases in turn,
+// stopping at the first that fails. Nothing is run for a dry run, or when hooks
+// are not allowed. A target directory created for the hooks to run in is
+// recorded in the journal.
+func (p *Pct) runHooks(plan deploymentPlan, phase string, commands []string, journal *rollback) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	if plan.info.DryRun {
+		for _, command := range commands {
+			log.Info().Msgf("Would run %s hook: %s", phase, command)
+		}
+		return nil
+	}
+
+	if !hooksAllowed(plan) {
+		log.Warn().Msgf("Not running the %s hooks of '%s'; review them and use --allow-hooks, or add '%s' to trusted_hooks to always run them", phase, plan.info.SelectedTemplate, HooksDigest(plan.tmpl))
+		return nil
+	}
+
+	if p.Exec == nil {
+		return fmt.Errorf("Unable to run %s hooks", phase)
+	}
+
+	targetDir := plan.info.TargetOutputDir
+	if err := journal.track(p.AFS, targetDir); err != nil {
+		return err
+	}
+	if err := p.AFS.MkdirAll(targetDir, 0750); err != nil {
+		return err
+	}
+
+	for _, command := range commands {
+		log.Info().Msgf("Running %s hook: %s", phase, command)
+		name, args := shellCommand(command)
+		if err := p.Exec.Command(name, args...); err != nil {
+			return fmt.Errorf("Unable to run %s hook '%s': %v", phase, command, err)
+		}
+		p.Exec.SetDir(targetDir)
+		p.Exec.SetEnv(
+			"PCT_TARGET_DIR="+targetDir,
+			"PCT_TARGET_NAME="+plan.info.TargetName,
+			"PCT_TEMPLATE_DIR="+plan.info.TemplateDirPath,
+		)
+		// Stdout is kept clear for the deployment's own output
+		p.Exec.SetOutput(os.Stderr, os.Stderr)
+		p.Exec.SetTimeout(plan.hooks.timeout)
+		if err := p.Exec.Run(); err != nil {
+			return fmt.Errorf("The %s hook '%s' failed: %v", phase, command, err)
+		}
+	}
+	return nil
+}
+
+// shellCommand runs a command line through the platform's shell; on Windows
+// exec_runner already runs every command through cmd.exe
+func shellCommand(command string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return command, nil
+	}
+	return "sh", []string{"-c", command}
+}
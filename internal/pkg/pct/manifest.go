@@ -0,0 +1,207 @@
+package pct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	ManifestDirName  = ".pct"
+	ManifestFileName = "manifest.yml"
+)
+
+// Manifest records which templates generated the content of a directory, and
+// with what values, so the content can be audited and regenerated
+type Manifest struct {
+	Templates []ManifestEntry `yaml:"templates"`
+}
+
+// ManifestEntry records a single deployment of a template
+type ManifestEntry struct {
+	Author     string                 `yaml:"author"`
+	Id         string                 `yaml:"id"`
+	Version    string                 `yaml:"version"`
+	Name       string                 `yaml:"name"`
+	PctVersion string                 `yaml:"pct_version"`
+	Values     map[string]interface{} `yaml:"values"`
+	// Dependency is set when the template was only deployed as a dependency of
+	// another, which deploys it again when replayed
+	Dependency bool `yaml:"dependency,omitempty"`
+	// Files maps the path of each deployed file, relative to the manifest's
+	// directory, to the SHA-256 of its content
+	Files map[string]string `yaml:"files"`
+}
+
+// recordedSources are the layers of values a manifest records: those the user
+// chose. The template's own values, including its defaults and its template
+// section, are read from whichever version renders the content, so a newer
+// version's defaults take effect when content is updated. Values describing
+// the machine, git, the environment or the target are looked up again whenever
+// content is rendered, and computed values are computed again.
+var recordedSources = []string{"user ", "workspace ", "manifest", "values file ", "--set", "deployment"}
+
+// templateInfoKey is the section of the values holding the template's own
+// metadata, which is never recorded
+const templateInfoKey = "template"
+
+// recordedValues returns the values of a deployment that its manifest records,
+// given the layer each was resolved from. The name of the content, pct_name, is
+// always recorded, so replaying it deploys under the same name.
+func recordedValues(config map[string]interface{}, sources map[string]string) map[string]interface{} {
+	flattened := make(map[string]interface{})
+	flattenValues("", withoutTemplateInfo(config), flattened)
+
+	recorded := map[string]interface{}{"pct_name": config["pct_name"]}
+	for key, value := range flattened {
+		for _, source := range recordedSources {
+			if strings.HasPrefix(sources[key], source) {
+				setValue(recorded, key, value)
+				break
+			}
+		}
+	}
+	return recorded
+}
+
+// withoutTemplateInfo returns values without the template's metadata section,
+// which manifests written by earlier versions of pct may have recorded
+func withoutTemplateInfo(values map[string]interface{}) map[string]interface{} {
+	if _, found := values[templateInfoKey]; !found {
+		return values
+	}
+	filtered := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if key != templateInfoKey {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// ManifestPath returns the location of the manifest for content deployed to
+// targetDir
+func ManifestPath(targetDir string) string {
+	return filepath.Join(targetDir, ManifestDirName, ManifestFileName)
+}
+
+// textChecksum returns the SHA-256 of rendered content, as recorded in a
+// manifest
+func textChecksum(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// fileChecksum returns the SHA-256 of a file's content, reading it as a stream
+func (p *Pct) fileChecksum(path string) (string, error) {
+	file, err := p.AFS.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error().Msgf("Error closing file: %s", err)
+		}
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ReadManifest reads and parses a manifest file
+func (p *Pct) ReadManifest(manifestFile string) (Manifest, error) {
+	var manifest Manifest
+
+	content, err := p.AFS.ReadFile(manifestFile)
+	if err != nil {
+		return manifest, fmt.Errorf("Unable to read manifest '%s': %v", manifestFile, err)
+	}
+
+	err = yaml.Unmarshal(content, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("Unable to parse manifest '%s': %v", manifestFile, err)
+	}
+
+	return manifest, nil
+}
+
+// FindEntry returns the most recent entry for a template
+func (m *Manifest) FindEntry(author string, id string) (ManifestEntry, bool) {
+	for i := len(m.Templates) - 1; i >= 0; i-- {
+		if m.Templates[i].Author == author && m.Templates[i].Id == id {
+			return m.Templates[i], true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// recordDeployment adds the entry for a deployed template to the manifest of its
+// target directory, replacing any earlier deployment of the same template with
+// the same name. Failing to record a deployment is logged
+// but does not fail the deployment itself.
+func (p *Pct) recordDeployment(plan deploymentPlan) {
+	entry := ManifestEntry{
+		Author:     plan.tmpl.Template.Author,
+		Id:         plan.tmpl.Template.Id,
+		Version:    plan.tmpl.Template.Version,
+		Name:       plan.info.TargetName,
+		PctVersion: plan.info.PdkInfo.Version,
+		Values:     plan.recorded,
+		Dependency: plan.info.targetResolved,
+		Files:      make(map[string]string),
+	}
+
+	for _, f := range plan.files {
+		if f.templateFile.IsDirectory || f.action == DeployActionSkip || f.action == DeployActionExclude {
+			continue
+		}
+		relativePath, err := filepath.Rel(plan.info.TargetOutputDir, f.templateFile.TargetFilePath)
+		if err != nil {
+			continue
+		}
+		entry.Files[filepath.ToSlash(relativePath)] = f.checksum
+	}
+
+	manifestFile := ManifestPath(plan.info.TargetOutputDir)
+	manifest, err := p.ReadManifest(manifestFile)
+	if err != nil {
+		log.Trace().Msgf("Starting a new manifest: %v", err)
+	}
+
+	replaced := false
+	for i, existing := range manifest.Templates {
+		if existing.Author == entry.Author && existing.Id == entry.Id && existing.Name == entry.Name {
+			// A template deployed in its own right stays so when deployed as a dependency
+			entry.Dependency = entry.Dependency && existing.Dependency
+			manifest.Templates[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		manifest.Templates = append(manifest.Templates, entry)
+	}
+
+	content, err := yaml.Marshal(manifest)
+	if err != nil {
+		log.Error().Msgf("Unable to record deployment: %v", err)
+		return
+	}
+
+	log.Debug().Msgf("Recording deployment in: %s", manifestFile)
+	err = p.AFS.MkdirAll(filepath.Dir(manifestFile), 0750)
+	if err == nil {
+		err = p.AFS.WriteFile(manifestFile, content, 0640)
+	}
+	if err != nil {
+		log.Error().Msgf("Unable to record deployment: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package pct
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ModuleMetadataFileName is the file at the root of a Puppet module describing it
+const ModuleMetadataFileName = "metadata.json"
+
+// moduleMetadata is the part of a Puppet module's metadata.json made available
+// to item templates deployed into the module
+type moduleMetadata struct {
+	Name                   string        `json:"name"`
+	Author                 string        `json:"author"`
+	Version                string        `json:"version"`
+	Dependencies           []interface{} `json:"dependencies"`
+	OperatingsystemSupport []interface{} `json:"operatingsystem_support"`
+}
+
+// moduleValues returns the puppet_module values describing the module an item
+// template is deployed into, read from the module's metadata.json, so content
+// such as classes can be namespaced to it. Nothing is returned for project
+// templates, which create a new project rather than add to one, or when the
+// target isn't a module.
+func (p *Pct) moduleValues(tmpl PuppetContentTemplateInfo, targetDir string) map[string]interface{} {
+	if tmpl.Template.Type != "item" {
+		return nil
+	}
+
+	metadataFile := filepath.Join(targetDir, ModuleMetadataFileName)
+	content, err := p.AFS.ReadFile(metadataFile)
+	if err != nil {
+		log.Trace().Msgf("Not deploying into a module: %v", err)
+		return nil
+	}
+
+	var metadata moduleMetadata
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		log.Warn().Msgf("Ignoring the module's metadata, unable to parse '%s': %v", metadataFile, err)
+		return nil
+	}
+
+	module := make(map[string]interface{})
+	if metadata.Name != "" {
+		module["name"] = metadata.Name
+		module["short_name"] = moduleShortName(metadata.Name)
+	}
+	if metadata.Author != "" {
+		module["author"] = metadata.Author
+	}
+	if metadata.Version != "" {
+		module["version"] = metadata.Version
+	}
+	if metadata.Dependencies != nil {
+		module["dependencies"] = metadata.Dependencies
+	}
+	if metadata.OperatingsystemSupport != nil {
+		module["operatingsystem_support"] = metadata.OperatingsystemSupport
+	}
+	return map[string]interface{}{"puppet_module": module}
+}
+
+// moduleShortName returns the name of a module without its author, eg widget
+// for acme-widget or acme/widget
+func moduleShortName(name string) string {
+	if i := strings.LastIndexAny(name, "-/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
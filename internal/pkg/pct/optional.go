@@ -0,0 +1,100 @@
+package pct
+
+import (
+	"strconv"
+	"text/template"
+	"text/template/parse"
+)
+
+const getFunc = "get"
+
+// optionalFuncs are the template functions that handle a missing value
+// themselves, so are given values looked up with get
+var optionalFuncs = map[string]bool{"default": true, "required": true}
+
+// allowOptionalValues rewrites every template in a set so that the values given
+// to default and required, eg {{ .license | default "MIT" }}, are looked up
+// with get. A missing value is then passed on to the function, as it is
+// without missingkey=error, rather than failing rendering in strict mode.
+func allowOptionalValues(set *template.Template) {
+	for _, t := range set.Templates() {
+		if t.Tree != nil {
+			lookupOptionalValues(t.Tree.Root)
+		}
+	}
+}
+
+func lookupOptionalValues(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			lookupOptionalValues(child)
+		}
+	case *parse.ActionNode:
+		lookupOptionalValues(n.Pipe)
+	case *parse.IfNode:
+		lookupOptionalValues(&n.BranchNode)
+	case *parse.RangeNode:
+		lookupOptionalValues(&n.BranchNode)
+	case *parse.WithNode:
+		lookupOptionalValues(&n.BranchNode)
+	case *parse.BranchNode:
+		lookupOptionalValues(n.Pipe)
+		lookupOptionalValues(n.List)
+		lookupOptionalValues(n.ElseList)
+	case *parse.TemplateNode:
+		lookupOptionalValues(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for i, cmd := range n.Cmds {
+			if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && optionalFuncs[ident.Ident] {
+				for j, arg := range cmd.Args[1:] {
+					if lookup := optionalLookup(arg); lookup != nil {
+						cmd.Args[j+1] = &parse.PipeNode{NodeType: parse.NodePipe, Pos: lookup.Pos, Cmds: []*parse.CommandNode{lookup}}
+					}
+				}
+				// The value piped in, eg .license | default "MIT"
+				if i > 0 && len(n.Cmds[i-1].Args) == 1 {
+					if lookup := optionalLookup(n.Cmds[i-1].Args[0]); lookup != nil {
+						n.Cmds[i-1] = lookup
+					}
+				}
+			}
+			for _, arg := range cmd.Args {
+				lookupOptionalValues(arg)
+			}
+		}
+	}
+}
+
+// optionalLookup returns a call to get equivalent to a field, eg .a.b becomes
+// get . "a" "b" and $x.a becomes get $x "a", or nil for any other node
+func optionalLookup(node parse.Node) *parse.CommandNode {
+	var receiver parse.Node
+	var keys []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		receiver = &parse.DotNode{NodeType: parse.NodeDot, Pos: n.Pos}
+		keys = n.Ident
+	case *parse.VariableNode:
+		if len(n.Ident) < 2 {
+			return nil
+		}
+		receiver = &parse.VariableNode{NodeType: parse.NodeVariable, Pos: n.Pos, Ident: n.Ident[:1]}
+		keys = n.Ident[1:]
+	default:
+		return nil
+	}
+
+	pos := node.Position()
+	args := []parse.Node{parse.NewIdentifier(getFunc).SetPos(pos), receiver}
+	for _, key := range keys {
+		args = append(args, &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(key), Text: key})
+	}
+	return &parse.CommandNode{NodeType: parse.NodeCommand, Pos: pos, Args: args}
+}
@@ -0,0 +1,218 @@
+package pct
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/puppetlabs/pct/pkg/utils"
+)
+
+// Types a template parameter can declare
+const (
+	ParameterTypeString  = "string"
+	ParameterTypeInteger = "integer"
+	ParameterTypeNumber  = "number"
+	ParameterTypeBoolean = "boolean"
+	ParameterTypeList    = "list"
+	ParameterTypeMap     = "map"
+)
+
+// ParameterTypes lists every valid parameter type
+var ParameterTypes = []string{
+	ParameterTypeString,
+	ParameterTypeInteger,
+	ParameterTypeNumber,
+	ParameterTypeBoolean,
+	ParameterTypeList,
+	ParameterTypeMap,
+}
+
+// TemplateParameter describes a single value a template accepts, as declared in
+// the parameters section of its configuration. Name may be dotted to describe a
+// nested value, eg puppet_module.author. Min and Max bound the value of numbers
+// and the length of strings and lists.
+type TemplateParameter struct {
+	Name        string        `mapstructure:"name"`
+	Type        string        `mapstructure:"type"`
+	Description string        `mapstructure:"description"`
+	Default     interface{}   `mapstructure:"default"`
+	Enum        []interface{} `mapstructure:"enum"`
+	Pattern     string        `mapstructure:"pattern"`
+	Required    bool          `mapstructure:"required"`
+	Min         *float64      `mapstructure:"min"`
+	Max         *float64      `mapstructure:"max"`
+}
+
+// ValidateParameterSchema checks that a template's parameter declarations are
+// themselves valid, returning every problem found
+func ValidateParameterSchema(params []TemplateParameter) error {
+	var problems []string
+	seen := make(map[string]bool)
+
+	for i, param := range params {
+		name := param.Name
+		if name == "" {
+			problems = append(problems, fmt.Sprintf("parameter %d: a name is required", i+1))
+			name = fmt.Sprintf("parameter %d", i+1)
+		} else if seen[strings.ToLower(name)] {
+			problems = append(problems, fmt.Sprintf("%s: is declared more than once", name))
+		}
+		seen[strings.ToLower(name)] = true
+
+		if param.Type != "" && !utils.Contains(ParameterTypes, param.Type) {
+			problems = append(problems, fmt.Sprintf("%s: unknown type '%s', expected one of: %s", name, param.Type, strings.Join(ParameterTypes, ", ")))
+			continue
+		}
+		if param.Pattern != "" {
+			if _, err := regexp.Compile(param.Pattern); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid pattern: %v", name, err))
+				continue
+			}
+		}
+		if param.Min != nil && param.Max != nil && *param.Min > *param.Max {
+			problems = append(problems, fmt.Sprintf("%s: min %v is greater than max %v", name, *param.Min, *param.Max))
+			continue
+		}
+		for _, e := range param.Enum {
+			if msg := checkParameterType(param, e); msg != "" {
+				problems = append(problems, fmt.Sprintf("%s: enum value %v %s", name, e, msg))
+			}
+		}
+		if param.Default != nil {
+			if msg := param.check(param.Default); msg != "" {
+				problems = append(problems, fmt.Sprintf("%s: default %s", name, msg))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid parameters:\n  * %s", strings.Join(problems, "\n  * "))
+	}
+	return nil
+}
+
+// ValidateParameters checks the merged values for a deployment against a
+// template's parameter declarations, returning a message for every parameter
+// that does not conform
+func ValidateParameters(params []TemplateParameter, values map[string]interface{}) error {
+	var problems []string
+	for _, param := range params {
+		if msg := param.Validate(values); msg != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", param.Name, msg))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("Invalid template values:\n  * %s", strings.Join(problems, "\n  * "))
+	}
+	return nil
+}
+
+// Validate checks the parameter's value within a set of values, returning a
+// description of the problem or an empty string when the value is valid
+func (param TemplateParameter) Validate(values map[string]interface{}) string {
+	value, ok := lookupValue(values, param.Name)
+	if !ok || value == nil || value == "" {
+		if param.Required {
+			return "a value is required"
+		}
+		return ""
+	}
+	return param.check(value)
+}
+
+// check validates a value that is present against the parameter's type, enum,
+// pattern and bounds
+func (param TemplateParameter) check(value interface{}) string {
+	if msg := checkParameterType(param, value); msg != "" {
+		return msg
+	}
+
+	if len(param.Enum) > 0 {
+		found := false
+		var allowed []string
+		for _, e := range param.Enum {
+			allowed = append(allowed, fmt.Sprint(e))
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Sprintf("%v must be one of: %s", value, strings.Join(allowed, ", "))
+		}
+	}
+
+	if param.Pattern != "" {
+		s, isString := value.(string)
+		re, err := regexp.Compile(param.Pattern)
+		if err == nil && isString && !re.MatchString(s) {
+			return fmt.Sprintf("'%s' does not match pattern '%s'", s, param.Pattern)
+		}
+	}
+
+	size, measure := parameterSize(value)
+	if param.Min != nil && size < *param.Min {
+		return fmt.Sprintf("%s %v is less than the minimum of %v", measure, size, *param.Min)
+	}
+	if param.Max != nil && size > *param.Max {
+		return fmt.Sprintf("%s %v is greater than the maximum of %v", measure, size, *param.Max)
+	}
+
+	return ""
+}
+
+// checkParameterType reports a problem when a value is not of the parameter's
+// declared type. Parameters without a type accept any value.
+func checkParameterType(param TemplateParameter, value interface{}) string {
+	valid := true
+	switch param.Type {
+	case ParameterTypeString:
+		_, valid = value.(string)
+	case ParameterTypeBoolean:
+		_, valid = value.(bool)
+	case ParameterTypeInteger:
+		n, isNumber := toFloat(value)
+		valid = isNumber && n == float64(int64(n))
+	case ParameterTypeNumber:
+		_, valid = toFloat(value)
+	case ParameterTypeList:
+		kind := reflect.ValueOf(value).Kind()
+		valid = kind == reflect.Slice || kind == reflect.Array
+	case ParameterTypeMap:
+		valid = reflect.ValueOf(value).Kind() == reflect.Map
+	}
+	if !valid {
+		return fmt.Sprintf("must be of type %s", param.Type)
+	}
+	return ""
+}
+
+// parameterSize returns what Min and Max bound for a value: the value of a
+// number, otherwise the length of a string, list or map
+func parameterSize(value interface{}) (float64, string) {
+	if n, ok := toFloat(value); ok {
+		return n, "value"
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "length"
+	}
+	return 0, "value"
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,149 @@
+package pct
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/puppetlabs/pct/pkg/template_funcs"
+	"github.com/spf13/afero"
+)
+
+// PartialsDirName is the directory of a template, alongside its content, that
+// holds snippets shared between its files
+const PartialsDirName = "partials"
+
+// loadPartials parses every file in a template's partials directory into the
+// template set each of its content files is parsed into. A partial is named by
+// its path relative to the directory, without any .tmpl extension, so
+// partials/license_header.tmpl is used with {{ template "license_header" . }}.
+// Partials may also define further named templates. They are parsed with the
+// template's delimiters, if it sets any.
+func loadPartials(afs *afero.Afero, templateDirPath string, delimiters []string) (*template.Template, error) {
+	partials := template.New("").Funcs(template_funcs.FuncMap()).Delims(delims(delimiters))
+
+	dir := filepath.Join(templateDirPath, PartialsDirName)
+	if exists, _ := afs.DirExists(dir); !exists {
+		return partials, nil
+	}
+
+	err := afs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), TemplateFileExtension)
+
+		content, err := afs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := partials.New(name).Parse(string(content)); err != nil {
+			return fmt.Errorf("Unable to parse partial '%s': %v", name, err)
+		}
+		return nil
+	})
+	allowOptionalValues(partials)
+	return partials, err
+}
+
+// CheckPartials checks that every partial used by a template's content files
+// and partials is defined, returning the references that are not. Files are
+// parsed with the delimiters tmpl sets for them.
+func CheckPartials(afs *afero.Afero, templateDirPath string, tmpl PuppetContentTemplateInfo) error {
+	partials, err := loadPartials(afs, templateDirPath, tmpl.Delimiters)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, t := range partials.Templates() {
+		for _, name := range missingPartials(partials, t) {
+			problems = append(problems, fmt.Sprintf("%s/%s: %s", PartialsDirName, t.Name(), name))
+		}
+	}
+
+	contentDir := filepath.Join(templateDirPath, "content")
+	if exists, _ := afs.DirExists(contentDir); !exists {
+		return nil
+	}
+	err = afs.Walk(contentDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, TemplateFileExtension) {
+			return err
+		}
+
+		content, err := afs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		set, err := partials.Clone()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(templateDirPath, path)
+		contentRel, _ := filepath.Rel(contentDir, path)
+		t, err := set.New(filepath.ToSlash(rel)).Delims(delims(fileDelimiters(tmpl, contentRel))).Parse(string(content))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", filepath.ToSlash(rel), err))
+			return nil
+		}
+		for _, name := range missingPartials(set, t) {
+			problems = append(problems, fmt.Sprintf("%s: %s", filepath.ToSlash(rel), name))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("Missing partials:\n  * %s", strings.Join(problems, "\n  * "))
+	}
+	return nil
+}
+
+// missingPartials returns the names of the templates used by t that are not
+// defined in set
+func missingPartials(set *template.Template, t *template.Template) []string {
+	if t.Tree == nil {
+		return nil
+	}
+
+	var missing []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			if set.Lookup(n.Name) == nil {
+				missing = append(missing, n.Name)
+			}
+		}
+	}
+	walk(t.Tree.Root)
+	return missing
+}
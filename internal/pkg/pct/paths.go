@@ -0,0 +1,63 @@
+package pct
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// missingValue is what a missing value renders as without missingkey=error
+const missingValue = "<no value>"
+
+// renderTargetPath renders the path of a file or directory relative to a
+// template's content directory into its path within the target directory.
+// Each segment of the path is rendered with the merged values, so content can
+// be named after any value, eg manifests/{{ .class_name }}.pp. The shorthands
+// {{pct_name}} and {{item}} are still supported, and the .tmpl extension of
+// template files is dropped. An empty path is returned when a whole segment
+// renders empty or is a single missing value, which skips the content. Any
+// other segment using a missing value is an error, as is any missing value when
+// strict. Paths that would be deployed outside of the target directory are an
+// error.
+func renderTargetPath(rel string, isTemplate bool, targetDir string, config map[string]interface{}, strict bool) (string, error) {
+	var options []string
+	if strict {
+		options = append(options, "missingkey=error")
+	}
+
+	if rel == "." {
+		return targetDir, nil
+	}
+
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i, segment := range segments {
+		if i == len(segments)-1 && isTemplate {
+			segment = strings.TrimSuffix(segment, TemplateFileExtension)
+		}
+		if strings.Contains(segment, "{{") {
+			segment = strings.ReplaceAll(segment, "{{pct_name}}", "{{ .pct_name }}")
+			segment = strings.ReplaceAll(segment, "{{item}}", "{{ .item }}")
+			rendered, err := renderString(segment, config, options...)
+			if err != nil {
+				return "", fmt.Errorf("Unable to render the path '%s': %v", rel, err)
+			}
+			segment = strings.TrimSpace(rendered)
+			if segment == missingValue {
+				segment = ""
+			}
+			if strings.Contains(segment, missingValue) {
+				return "", fmt.Errorf("Unable to render the path '%s': it uses a value that is not set", rel)
+			}
+		}
+		if segment == "" {
+			return "", nil
+		}
+		segments[i] = segment
+	}
+
+	target := filepath.Join(targetDir, filepath.FromSlash(strings.Join(segments, "/")))
+	if relTarget, err := filepath.Rel(targetDir, target); err != nil || relTarget == ".." || strings.HasPrefix(relTarget, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("The path '%s' renders to '%s', which is outside of the target directory", rel, target)
+	}
+	return target, nil
+}
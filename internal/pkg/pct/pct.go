@@ -12,16 +12,21 @@ package pct
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/hashicorp/go-version"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/olekukonko/tablewriter"
+	"github.com/puppetlabs/pct/pkg/exec_runner"
+	"github.com/puppetlabs/pct/pkg/ignore"
 	"github.com/puppetlabs/pct/pkg/install"
 	"github.com/puppetlabs/pct/pkg/utils"
 	"github.com/rs/zerolog/log"
@@ -35,14 +40,42 @@ const (
 	TemplateConfigFileName     = "pct-config.yml"
 	UserTemplateConfigName     = "pct"
 	UserTemplateConfigFileName = "pct.yml"
+	TemplateFileExtension      = ".tmpl"
+	EnvironmentValuePrefix     = "PCT_VALUE_"
 )
 
 // PuppetContentTemplateInfo is the housing struct for marshaling YAML data
 type PuppetContentTemplateInfo struct {
-	Template PuppetContentTemplate `mapstructure:"template"`
-	Defaults map[string]interface{}
+	Template     PuppetContentTemplate  `mapstructure:"template"`
+	Files        []TemplateFileConfig   `mapstructure:"files"`
+	Parameters   []TemplateParameter    `mapstructure:"parameters"`
+	Include      []TemplateFileRule     `mapstructure:"include"`
+	Exclude      []TemplateFileRule     `mapstructure:"exclude"`
+	Hooks        TemplateHooks          `mapstructure:"hooks"`
+	Dependencies []TemplateDependency   `mapstructure:"dependencies"`
+	Ignore       []string               `mapstructure:"ignore"`
+	Strict       bool                   `mapstructure:"strict"`
+	Computed     map[string]interface{} `mapstructure:"computed"`
+	Delimiters   []string               `mapstructure:"delimiters"`
+	Defaults     map[string]interface{}
 }
 
+// TemplateFileConfig holds per-file settings from the files section of a
+// template's configuration. Glob is matched against paths relative to the
+// template's content directory, with or without their .tmpl extension.
+// Foreach names a list value; each matching file is deployed once per entry.
+// Delimiters replace {{ and }} in matching template files.
+type TemplateFileConfig struct {
+	Glob       string   `mapstructure:"glob"`
+	Mode       string   `mapstructure:"mode"`
+	Foreach    string   `mapstructure:"foreach"`
+	Delimiters []string `mapstructure:"delimiters"`
+}
+
+// reservedConfigSections are the top level sections of a template's
+// configuration that control how it deploys rather than provide values to it
+var reservedConfigSections = []string{"files", "parameters", "include", "exclude", "hooks", "dependencies", "ignore", "strict", "computed", "delimiters"}
+
 // PuppetContentTemplate houses the actual information about each template
 type PuppetContentTemplate struct {
 	install.ConfigParams `mapstructure:",squash"`
@@ -59,6 +92,15 @@ type PuppetContentTemplateFileInfo struct {
 	TargetDir      string
 	TargetFile     string
 	IsDirectory    bool
+	IsTemplate     bool
+	Mode           os.FileMode
+	// Foreach names the list value a file was expanded over, and Item the
+	// entry of it this target is rendered with
+	Foreach string
+	Item    interface{}
+	// Delimiters are the left and right delimiters a template file is parsed
+	// with, or nil for the default {{ and }}
+	Delimiters []string
 }
 
 // PDKInfo contains the current version information of the compiled binary for
@@ -76,6 +118,50 @@ type DeployInfo struct {
 	TargetOutputDir  string
 	TargetName       string
 	PdkInfo          PDKInfo
+	DryRun           bool
+	OnConflict       string
+	ValueFiles       []string
+	SetValues        []string
+	Values           map[string]interface{}
+	AllowHooks       bool
+	// TrustedHooks are the HooksDigest of each template whose hooks the user
+	// trusts to run without AllowHooks
+	TrustedHooks []string
+	// Strict fails the deployment when a template file or content path uses a
+	// value that isn't set, rather than rendering "<no value>" or skipping it
+	Strict bool
+	// RecordedValues are the values content was originally generated with, as
+	// recorded in its manifest. They override configuration files, so content
+	// renders as it did then, and are overridden by ValueFiles and SetValues.
+	RecordedValues map[string]interface{}
+	// NoRootDetection deploys item templates without an output directory to the
+	// working directory, rather than the root of the project it is within
+	NoRootDetection bool
+
+	// targetResolved is set for dependencies, which deploy to the target their
+	// dependent template resolved
+	targetResolved bool
+}
+
+// Actions reported for each target of a deployment
+const (
+	DeployActionCreate    = "create"
+	DeployActionOverwrite = "overwrite"
+	DeployActionUnchanged = "unchanged"
+	DeployActionSkip      = "skip"
+	DeployActionBackup    = "backup"
+	DeployActionConflict  = "conflict"
+	DeployActionMerge     = "merge"
+	DeployActionExclude   = "exclude"
+)
+
+// DeployedFile represents the outcome of deploying a single template file or
+// directory. When DryRun is set the Action describes what would have happened
+// had the deployment been run for real.
+type DeployedFile struct {
+	Path   string
+	Action string
+	DryRun bool
 }
 
 type PctI interface {
@@ -83,15 +169,41 @@ type PctI interface {
 	List(templatePath string, templateName string) ([]PuppetContentTemplate, error)
 	FormatTemplates(tmpls []PuppetContentTemplate, jsonOutput string) error
 	DisplayDefaults(defaults map[string]interface{}, format string) string
-	FormatDeployment(deployed []string, jsonOutput string) error
-	Deploy(info DeployInfo) []string
+	FormatDeployment(deployed []DeployedFile, jsonOutput string) error
+	Deploy(info DeployInfo) ([]DeployedFile, error)
 }
 
 type Pct struct {
-	OsUtils utils.OsUtilI
-	Utils   utils.UtilsHelperI
-	AFS     *afero.Afero
-	IOFS    *afero.IOFS
+	OsUtils  utils.OsUtilI
+	Utils    utils.UtilsHelperI
+	AFS      *afero.Afero
+	IOFS     *afero.IOFS
+	Prompter PrompterI
+	Exec     exec_runner.ExecI
+}
+
+// plannedFile pairs a resolved template file with the action a deployment
+// will take for it and the SHA-256 of the content it deploys. Only rendered
+// templates hold their content; other files are streamed from the template
+// when written, so large files aren't held in memory.
+type plannedFile struct {
+	templateFile PuppetContentTemplateFileInfo
+	text         string
+	checksum     string
+	action       string
+}
+
+// deploymentPlan holds everything resolved while planning a deployment: the
+// deploy information with its target filled in, the template configuration,
+// the merged values used for rendering and each planned file
+type deploymentPlan struct {
+	info   DeployInfo
+	tmpl   PuppetContentTemplateInfo
+	config map[string]interface{}
+	// recorded are the values of config the manifest records
+	recorded map[string]interface{}
+	files    []plannedFile
+	hooks    renderedHooks
 }
 
 func (p *Pct) Get(templateDirPath string) (PuppetContentTemplate, error) {
@@ -216,11 +328,11 @@ func (*Pct) DisplayDefaults(defaults map[string]interface{}, format string) stri
 
 // FormatDeployment formats the files returned by the Deploy method to display
 // on the console in table format or json format.
-func (*Pct) FormatDeployment(deployed []string, jsonOutput string) error {
+func (*Pct) FormatDeployment(deployed []DeployedFile, jsonOutput string) error {
 	switch jsonOutput {
 	case "table":
 		for _, d := range deployed {
-			log.Info().Msgf("Deployed: %v", d)
+			log.Info().Msgf("%s: %v", deploymentLabel(d), d.Path)
 		}
 	case "json":
 		j := jsoniter.ConfigFastest
@@ -230,25 +342,200 @@ func (*Pct) FormatDeployment(deployed []string, jsonOutput string) error {
 	return nil
 }
 
+func deploymentLabel(d DeployedFile) string {
+	switch d.Action {
+	case DeployActionUnchanged:
+		return "Unchanged"
+	case DeployActionConflict:
+		return "Conflict"
+	case DeployActionExclude:
+		return "Excluded"
+	}
+
+	if d.DryRun {
+		switch d.Action {
+		case DeployActionCreate:
+			return "Would create"
+		case DeployActionOverwrite:
+			return "Would overwrite"
+		case DeployActionBackup:
+			return "Would back up and overwrite"
+		case DeployActionSkip:
+			return "Would skip"
+		case DeployActionMerge:
+			return "Would merge"
+		}
+	}
+
+	switch d.Action {
+	case DeployActionBackup:
+		return "Deployed (backed up to " + BackupFileSuffix + ")"
+	case DeployActionSkip:
+		return "Skipped"
+	case DeployActionMerge:
+		return "Merged"
+	}
+	return "Deployed"
+}
+
 // Deploy deploys a selected template to a target path with a target name using
 // data from both the configuration inside the template and provided by the
-// User in their user config file
-func (p *Pct) Deploy(info DeployInfo) []string {
+// User in their user config file. When info.DryRun is set nothing is written to
+// disk; the returned files instead describe what a deployment would do.
+//
+// Existing target files with different content are handled according to
+// info.OnConflict. Each template is rendered in full, and all of its conflicts
+// resolved, before any of its files are written. If a file fails to render or
+// be written, or the deployment is aborted, every change made to the target is
+// rolled back and an error returned. Files that fail to render are all reported
+// together as RenderErrors. When info.Strict is set, or the template sets strict,
+// using a value that isn't set is an error rather than rendering "<no value>".
+//
+// Templates the selected template depends on are deployed into the same target
+// first. Every template is resolved and its values validated before anything is
+// deployed.
+//
+// Each template's pre_deploy hooks run before its files are written, and every
+// template's post_deploy hooks once all files have been, but only when
+// info.AllowHooks is set or the template's HooksDigest is one of info.TrustedHooks.
+// Failing post_deploy hooks are reported, alongside the files deployed, but don't
+// roll back the deployment.
+func (p *Pct) Deploy(info DeployInfo) ([]DeployedFile, error) {
+	if err := validateConflictPolicy(info.OnConflict); err != nil {
+		return nil, err
+	}
+
+	chain, err := p.resolveDependencies(info, nil, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &rollback{}
+	var plans []deploymentPlan
+	var deployed []DeployedFile
+	for _, i := range chain {
+		plan, d, err := p.deployTemplate(i, journal)
+		if err != nil {
+			journal.undo(p.AFS)
+			return nil, err
+		}
+		plans = append(plans, plan)
+		deployed = append(deployed, d...)
+	}
+
+	for _, plan := range plans {
+		if !plan.info.DryRun {
+			p.recordDeployment(plan)
+		}
+	}
+
+	// Hooks may have made changes of their own, so a deployment isn't rolled
+	// back once it reaches them
+	for _, plan := range plans {
+		if err := p.runHooks(plan, "post_deploy", plan.hooks.postDeploy, journal); err != nil {
+			return deployed, err
+		}
+	}
+
+	return deployed, nil
+}
+
+// deployTemplate renders a single template, without its dependencies, and
+// writes the result to its target, recording every change in the journal. It
+// stops at the first file that can't be written.
+func (p *Pct) deployTemplate(info DeployInfo, journal *rollback) (deploymentPlan, []DeployedFile, error) {
+	plan, err := p.planDeployment(info)
+	if err != nil {
+		return plan, nil, err
+	}
+	planned := plan.files
+
+	var conflicts []string
+	for i, f := range planned {
+		if f.action != DeployActionOverwrite {
+			continue
+		}
+		action, err := p.resolveConflict(info, f.templateFile.TargetFilePath)
+		if err != nil {
+			return plan, nil, err
+		}
+		if action == DeployActionConflict {
+			conflicts = append(conflicts, f.templateFile.TargetFilePath)
+		}
+		planned[i].action = action
+	}
+
+	if len(conflicts) > 0 && !info.DryRun {
+		return plan, nil, fmt.Errorf("Refusing to overwrite existing files:\n  * %s", strings.Join(conflicts, "\n  * "))
+	}
+
+	if err := p.runHooks(plan, "pre_deploy", plan.hooks.preDeploy, journal); err != nil {
+		return plan, nil, err
+	}
+
+	var deployed []DeployedFile
+	for _, f := range planned {
+		if !info.DryRun {
+			log.Debug().Msgf("Deploying: %s", f.templateFile.TargetFilePath)
+			if err := p.applyPlannedFile(f, journal); err != nil {
+				return plan, nil, fmt.Errorf("Unable to deploy '%s': %v", f.templateFile.TargetFilePath, err)
+			}
+		}
+		deployed = append(deployed, DeployedFile{Path: f.templateFile.TargetFilePath, Action: f.action, DryRun: info.DryRun})
+	}
 
+	return plan, deployed, nil
+}
+
+// prepareDeployment reads a template's configuration, resolves the target of a
+// deployment and merges the values it will be rendered with, returning an error
+// when they do not satisfy the template's parameters
+func (p *Pct) prepareDeployment(info DeployInfo) (deploymentPlan, error) {
 	log.Trace().Msgf("PDKInfo: %+v", info.PdkInfo)
 
 	log.Debug().Msgf("Template: %s", info.TemplateDirPath)
 	tmpl := p.readTemplateConfig(filepath.Join(info.TemplateDirPath, TemplateConfigFileName))
 	log.Trace().Msgf("Parsed: %+v", tmpl)
 
+	// Dependencies deploy to the target resolved by the template depending on them
+	if !info.targetResolved {
+		info = p.resolveTarget(info, tmpl)
+	}
+
+	config, sources, err := p.processConfiguration(info, tmpl)
+	if err != nil {
+		return deploymentPlan{}, err
+	}
+	if err := ValidateParameters(tmpl.Parameters, config); err != nil {
+		return deploymentPlan{}, err
+	}
+
+	// Values can override the name, including where it's used in file names
+	if name, ok := config["pct_name"].(string); ok && name != "" {
+		info.TargetName = name
+	}
+
+	return deploymentPlan{info: info, tmpl: tmpl, config: config, recorded: recordedValues(config, sources)}, nil
+}
+
+// resolveTarget works out the output directory and name of a deployment from
+// those given, the working directory and the type of template. Item templates
+// without an output directory deploy to the root of the project the working
+// directory is within, unless info.NoRootDetection is set.
+func (p *Pct) resolveTarget(info DeployInfo, tmpl PuppetContentTemplateInfo) DeployInfo {
 	if info.TargetName == "" && info.TargetOutputDir == "" { // pdk new foo-foo
 		cwd, _ := p.OsUtils.Getwd()
+		if tmpl.Template.Type != "project" && !info.NoRootDetection {
+			cwd = p.FindProjectRoot(cwd)
+		}
 		info.TargetName = filepath.Base(cwd)
 		info.TargetOutputDir = cwd
 	} else if info.TargetName != "" && info.TargetOutputDir == "" { // pdk new foo-foo -n wakka
 		cwd, _ := p.OsUtils.Getwd()
 		if tmpl.Template.Type == "project" {
 			info.TargetOutputDir = filepath.Join(cwd, info.TargetName)
+		} else if !info.NoRootDetection {
+			info.TargetOutputDir = p.FindProjectRoot(cwd)
 		} else {
 			info.TargetOutputDir = cwd
 		}
@@ -260,62 +547,288 @@ func (p *Pct) Deploy(info DeployInfo) []string {
 		}
 	}
 
+	return info
+}
+
+// planDeployment resolves the target of every file and directory in a
+// template's content, renders each file in memory and compares it against the
+// target to decide whether it would be created, overwritten or left unchanged.
+// Nothing is written to disk. Files expanded with foreach are planned once per
+// item, and content dropped by the template's include and exclude rules is
+// planned as excluded. An error is returned when the merged values do not
+// satisfy the template's parameters or more than one file would be deployed to
+// the same target, and RenderErrors listing every file that could not be
+// rendered.
+func (p *Pct) planDeployment(info DeployInfo) (deploymentPlan, error) {
+	plan, err := p.prepareDeployment(info)
+	if err != nil {
+		return deploymentPlan{}, err
+	}
+	info, tmpl, config := plan.info, plan.tmpl, plan.config
+
+	excluded, err := evaluateFileRules(tmpl, config)
+	if err != nil {
+		return deploymentPlan{}, err
+	}
+	hooks, err := renderHooks(tmpl.Hooks, config)
+	if err != nil {
+		return deploymentPlan{}, err
+	}
+	if err := ValidateDelimiters(tmpl); err != nil {
+		return deploymentPlan{}, err
+	}
+	partials, err := loadPartials(p.AFS, info.TemplateDirPath, tmpl.Delimiters)
+	if err != nil {
+		return deploymentPlan{}, err
+	}
+	strict := info.Strict || tmpl.Strict
+	if strict {
+		partials.Option("missingkey=error")
+	}
+
 	contentDir := filepath.Join(info.TemplateDirPath, "content")
 	log.Debug().Msgf("Target Name: %s", info.TargetName)
 	log.Debug().Msgf("Target Output: %s", info.TargetOutputDir)
 
-	replacer := strings.NewReplacer(
-		contentDir, info.TargetOutputDir,
-		"{{pct_name}}", info.TargetName,
-		".tmpl", "",
-	)
-
+	ignored := ignore.New(tmpl.Ignore)
 	var templateFiles []PuppetContentTemplateFileInfo
-	err := p.AFS.Walk(contentDir, func(path string, info os.FileInfo, err error) error {
+	err = p.AFS.Walk(contentDir, func(path string, fileInfo os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
 		log.Trace().Msgf("Processing: %s", path)
-		targetFile := replacer.Replace(path)
-		log.Debug().Msgf("Resolved '%s' to '%s'", path, targetFile)
+		rel, err := filepath.Rel(contentDir, path)
+		if err != nil {
+			return err
+		}
+		if ignored.Match(filepath.ToSlash(rel), fileInfo.IsDir()) {
+			log.Debug().Msgf("Ignoring: %s", path)
+			if fileInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
-		dir, file := filepath.Split(targetFile)
 		i := PuppetContentTemplateFileInfo{
-			TemplatePath:   path,
-			TargetFilePath: targetFile,
-			TargetDir:      dir,
-			TargetFile:     file,
-			IsDirectory:    info.IsDir(),
+			TemplatePath: path,
+			IsDirectory:  fileInfo.IsDir(),
+			IsTemplate:   !fileInfo.IsDir() && strings.HasSuffix(path, TemplateFileExtension),
+			Mode:         fileInfo.Mode().Perm(),
+		}
+		if !i.IsDirectory {
+			i.Mode = fileMode(tmpl.Files, contentDir, path, i.Mode)
+		}
+		if i.IsTemplate {
+			i.Delimiters = fileDelimiters(tmpl, rel)
 		}
-		log.Trace().Msgf("Processed: %+v", i)
 
-		templateFiles = append(templateFiles, i)
+		resolved, err := p.resolveContentFile(tmpl, rel, i, info.TargetOutputDir, config, strict)
+		if err != nil {
+			return err
+		}
+		if len(resolved) == 0 && i.IsDirectory {
+			return filepath.SkipDir
+		}
+		templateFiles = append(templateFiles, resolved...)
 		return nil
 	})
 	if err != nil {
-		log.Error().AnErr("content", err)
+		return deploymentPlan{}, err
 	}
 
-	var deployed []string
+	var planned []plannedFile
+	var renderErrors RenderErrors
 	for _, templateFile := range templateFiles {
-		log.Debug().Msgf("Deploying: %s", templateFile.TargetFilePath)
+		log.Debug().Msgf("Planning: %s", templateFile.TargetFilePath)
+		if rel, err := filepath.Rel(contentDir, templateFile.TemplatePath); err == nil && matchesContentRule(excluded, rel) {
+			log.Debug().Msgf("Excluded by template rules: %s", templateFile.TargetFilePath)
+			planned = append(planned, plannedFile{templateFile: templateFile, action: DeployActionExclude})
+			continue
+		}
 		if templateFile.IsDirectory {
-			err := p.createTemplateDirectory(templateFile.TargetFilePath)
-			if err == nil {
-				deployed = append(deployed, templateFile.TargetFilePath)
-			}
-		} else {
-			err := p.createTemplateFile(info, templateFile, tmpl.Template)
-			if err != nil {
-				log.Error().Msgf("%s", err)
-				continue
-			}
-			deployed = append(deployed, templateFile.TargetFilePath)
+			planned = append(planned, plannedFile{
+				templateFile: templateFile,
+				action:       p.planTemplateDirectory(templateFile.TargetFilePath),
+			})
+			continue
+		}
+
+		values := config
+		if templateFile.Foreach != "" {
+			values = itemValues(config, templateFile.Item)
+		}
+		f, err := p.planContentFile(templateFile, partials, values)
+		if err != nil {
+			renderErrors = append(renderErrors, newRenderError(templateFile.TemplatePath, err))
+			continue
+		}
+		planned = append(planned, f)
+	}
+
+	if err := checkDuplicateTargets(planned); err != nil {
+		return deploymentPlan{}, err
+	}
+	if len(renderErrors) > 0 {
+		return deploymentPlan{}, renderErrors
+	}
+
+	plan.files = planned
+	plan.hooks = hooks
+	return plan, nil
+}
+
+// resolveContentFile resolves the targets a content file or directory deploys
+// to. Most resolve to a single target, but a file expanded with foreach
+// resolves to one for each item of its list, with the item bound in the values
+// its path is rendered with. Content whose path renders empty resolves to none.
+func (p *Pct) resolveContentFile(tmpl PuppetContentTemplateInfo, rel string, templateFile PuppetContentTemplateFileInfo, targetDir string, config map[string]interface{}, strict bool) ([]PuppetContentTemplateFileInfo, error) {
+	foreach := ""
+	if !templateFile.IsDirectory {
+		var err error
+		if foreach, err = p.contentForeach(tmpl.Files, rel, templateFile); err != nil {
+			return nil, err
+		}
+	}
+
+	items := []interface{}{nil}
+	if foreach != "" {
+		var err error
+		if items, err = foreachItems(foreach, config); err != nil {
+			return nil, fmt.Errorf("Unable to expand '%s': %v", templateFile.TemplatePath, err)
+		}
+	}
+
+	var resolved []PuppetContentTemplateFileInfo
+	for _, item := range items {
+		values := config
+		if foreach != "" {
+			values = itemValues(config, item)
+		}
+
+		targetFile, err := renderTargetPath(rel, templateFile.IsTemplate, targetDir, values, strict)
+		if err != nil {
+			return nil, err
+		}
+		if targetFile == "" {
+			log.Debug().Msgf("Skipping '%s', its path renders empty", templateFile.TemplatePath)
+			continue
+		}
+		log.Debug().Msgf("Resolved '%s' to '%s'", templateFile.TemplatePath, targetFile)
+
+		i := templateFile
+		i.TargetFilePath = targetFile
+		i.TargetDir, i.TargetFile = filepath.Split(targetFile)
+		if foreach != "" {
+			i.Foreach, i.Item = foreach, item
+		}
+		log.Trace().Msgf("Processed: %+v", i)
+		resolved = append(resolved, i)
+	}
+	return resolved, nil
+}
+
+// checkDuplicateTargets returns an error listing every target that more than
+// one planned file would be deployed to
+func checkDuplicateTargets(planned []plannedFile) error {
+	sources := make(map[string][]string)
+	var targets []string
+	for _, p := range planned {
+		f := p.templateFile
+		if f.IsDirectory || p.action == DeployActionExclude {
+			continue
+		}
+		if _, ok := sources[f.TargetFilePath]; !ok {
+			targets = append(targets, f.TargetFilePath)
+		}
+		sources[f.TargetFilePath] = append(sources[f.TargetFilePath], f.TemplatePath)
+	}
+
+	var duplicates []string
+	for _, target := range targets {
+		if len(sources[target]) > 1 {
+			duplicates = append(duplicates, fmt.Sprintf("%s: %s", target, strings.Join(sources[target], ", ")))
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("More than one file would be deployed to the same target:\n  * %s", strings.Join(duplicates, "\n  * "))
+	}
+	return nil
+}
+
+// applyPlannedFile carries out the planned action for a single target, first
+// recording what it changes in the journal so it can be rolled back
+func (p *Pct) applyPlannedFile(f plannedFile, journal *rollback) error {
+	target := f.templateFile.TargetFilePath
+	switch f.action {
+	case DeployActionCreate, DeployActionOverwrite, DeployActionBackup, DeployActionMerge, DeployActionConflict:
+		if err := journal.track(p.AFS, target); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	if f.templateFile.IsDirectory {
+		if f.action == DeployActionCreate {
+			return p.createTemplateDirectory(target)
+		}
+		return nil
+	}
+
+	switch f.action {
+	case DeployActionBackup:
+		if err := journal.track(p.AFS, target+BackupFileSuffix); err != nil {
+			return err
+		}
+		if err := p.backupFile(target); err != nil {
+			return err
+		}
+		return p.writeTemplateFile(f)
+	case DeployActionCreate, DeployActionOverwrite:
+		return p.writeTemplateFile(f)
+	case DeployActionMerge, DeployActionConflict:
+		if !f.templateFile.IsTemplate {
+			// Files copied verbatim can't be merged, so keep the working copy
+			return nil
 		}
+		return p.createTemplateFile(f.templateFile, f.text)
 	}
+	return nil
+}
 
-	return deployed
+// writeTemplateFile writes rendered templates to their target and streams every
+// other file across untouched, so binary content is never corrupted
+func (p *Pct) writeTemplateFile(f plannedFile) error {
+	if f.templateFile.IsTemplate {
+		return p.createTemplateFile(f.templateFile, f.text)
+	}
+	return p.copyTemplateFile(f.templateFile)
+}
+
+// planTemplateDirectory reports whether a target directory needs to be created
+func (p *Pct) planTemplateDirectory(targetDir string) string {
+	if exists, _ := p.AFS.DirExists(targetDir); exists {
+		return DeployActionUnchanged
+	}
+	return DeployActionCreate
+}
+
+// planTemplateFile compares the checksum of the content a file deploys and its
+// mode against any existing target file to report whether it would be created,
+// overwritten or left unchanged
+func (p *Pct) planTemplateFile(templateFile PuppetContentTemplateFileInfo, checksum string) string {
+	existing, err := p.fileChecksum(templateFile.TargetFilePath)
+	if err != nil {
+		return DeployActionCreate
+	}
+	if existing != checksum {
+		return DeployActionOverwrite
+	}
+	if stat, err := p.AFS.Stat(templateFile.TargetFilePath); err == nil && templateFile.Mode != 0 && stat.Mode().Perm() != templateFile.Mode {
+		return DeployActionOverwrite
+	}
+	return DeployActionUnchanged
 }
 
 func (p *Pct) createTemplateDirectory(targetDir string) error {
@@ -330,27 +843,39 @@ func (p *Pct) createTemplateDirectory(targetDir string) error {
 	return nil
 }
 
-func (p *Pct) createTemplateFile(info DeployInfo, templateFile PuppetContentTemplateFileInfo, tmpl PuppetContentTemplate) error {
-	log.Trace().Msgf("Creating: '%s'", templateFile.TargetFilePath)
-	config := p.processConfiguration(
-		info,
-		templateFile.TemplatePath,
-		tmpl,
-	)
-
-	text, err := p.renderFile(templateFile.TemplatePath, config)
-	if err != nil {
-		return fmt.Errorf("Failed to create %s", templateFile.TargetFilePath)
+// planContentFile plans a content file: .tmpl files are rendered, while the
+// checksum of any other file is read from it as a stream, as it's deployed
+// exactly as it is
+func (p *Pct) planContentFile(templateFile PuppetContentTemplateFileInfo, partials *template.Template, config map[string]interface{}) (plannedFile, error) {
+	f := plannedFile{templateFile: templateFile}
+	if templateFile.IsTemplate {
+		text, err := p.renderFile(templateFile.TemplatePath, templateFile.Delimiters, partials, config)
+		if err != nil {
+			return f, err
+		}
+		f.text = text
+		f.checksum = textChecksum(text)
+	} else {
+		checksum, err := p.fileChecksum(templateFile.TemplatePath)
+		if err != nil {
+			return f, err
+		}
+		f.checksum = checksum
 	}
 
+	f.action = p.planTemplateFile(templateFile, f.checksum)
+	return f, nil
+}
+
+func (p *Pct) createTemplateFile(templateFile PuppetContentTemplateFileInfo, text string) error {
 	log.Trace().Msgf("Writing: '%s' '%s'", templateFile.TargetFilePath, text)
-	err = p.AFS.MkdirAll(templateFile.TargetDir, os.ModePerm)
+	err := p.AFS.MkdirAll(templateFile.TargetDir, os.ModePerm)
 	if err != nil {
 		log.Error().Msgf("Error: %v", err)
 		return err
 	}
 
-	file, err := p.AFS.Create(templateFile.TargetFilePath)
+	file, err := p.openTargetFile(templateFile)
 	if err != nil {
 		log.Error().Msgf("Error: %v", err)
 		return err
@@ -376,102 +901,350 @@ func (p *Pct) createTemplateFile(info DeployInfo, templateFile PuppetContentTemp
 	return nil
 }
 
-func (p *Pct) processConfiguration(info DeployInfo, projectTemplate string, tmpl PuppetContentTemplate) map[string]interface{} {
+func (p *Pct) copyTemplateFile(templateFile PuppetContentTemplateFileInfo) error {
+	log.Trace().Msgf("Copying: '%s' to '%s'", templateFile.TemplatePath, templateFile.TargetFilePath)
+	err := p.AFS.MkdirAll(templateFile.TargetDir, os.ModePerm)
+	if err != nil {
+		log.Error().Msgf("Error: %v", err)
+		return err
+	}
+
+	source, err := p.AFS.Open(templateFile.TemplatePath)
+	if err != nil {
+		log.Error().Msgf("Error: %v", err)
+		return err
+	}
+	defer func() {
+		if err := source.Close(); err != nil {
+			log.Error().Msgf("Error closing file: %s\n", err)
+		}
+	}()
+
+	file, err := p.openTargetFile(templateFile)
+	if err != nil {
+		log.Error().Msgf("Error: %v", err)
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error().Msgf("Error closing file: %s\n", err)
+		}
+	}()
+
+	_, err = io.Copy(file, source)
+	if err != nil {
+		log.Error().Msgf("Error: %v", err)
+		return err
+	}
+
+	return file.Sync()
+}
+
+// openTargetFile creates or truncates a target file with the mode of its
+// template file. The mode is set explicitly afterwards, as OpenFile is subject
+// to the umask and leaves the mode of existing files untouched.
+func (p *Pct) openTargetFile(templateFile PuppetContentTemplateFileInfo) (afero.File, error) {
+	mode := templateFile.Mode
+	if mode == 0 {
+		mode = 0666
+	}
+
+	file, err := p.AFS.OpenFile(templateFile.TargetFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if templateFile.Mode != 0 {
+		if err := p.AFS.Chmod(templateFile.TargetFilePath, templateFile.Mode); err != nil {
+			file.Close() //nolint:errcheck
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+// fileMode returns the mode a content file deploys with: the mode of the last
+// matching entry in the template's files section, otherwise the mode of the
+// source file
+func fileMode(files []TemplateFileConfig, contentDir string, file string, mode os.FileMode) os.FileMode {
+	rel, err := filepath.Rel(contentDir, file)
+	if err != nil {
+		return mode
+	}
+
+	for _, f := range files {
+		if f.Mode == "" || !matchesContentGlob(f.Glob, rel) {
+			continue
+		}
+		parsed, err := strconv.ParseUint(f.Mode, 8, 32)
+		if err != nil {
+			log.Warn().Msgf("Ignoring invalid mode '%s' for '%s': modes must be quoted octal strings, eg '0755'", f.Mode, f.Glob)
+			continue
+		}
+		mode = os.FileMode(parsed).Perm()
+	}
+
+	return mode
+}
+
+// matchesContentGlob reports whether a path relative to the content directory
+// matches a glob from the template's files section. The .tmpl extension is
+// optional in the glob.
+func matchesContentGlob(glob string, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, candidate := range []string{rel, strings.TrimSuffix(rel, TemplateFileExtension)} {
+		if matched, _ := path.Match(glob, candidate); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// processConfiguration merges the values a deployment renders with, returning
+// them along with the layer each was resolved from
+func (p *Pct) processConfiguration(info DeployInfo, tmpl PuppetContentTemplateInfo) (map[string]interface{}, map[string]string, error) {
 	v := viper.New()
+	// sources records which layer each value was resolved from, for debugging
+	sources := make(map[string]string)
 
 	log.Trace().Msgf("PDKInfo: %+v", info.PdkInfo)
 	/*
 		Inheritance (each level overwritten by next):
 			convention based variables
 				- pdk specific variables based on transformed user input
+				- puppet_module values from the metadata.json of the module an item template is deployed into
 			machine variables
 				- information that comes from the current machine
 				- user name, hostname, etc
+				- git identity and repository details, eg. git.user.email, git.branch
 			template variables
-				- information from the template itself
+				- information from the template itself, including parameter defaults
 				- designed to be runnable defaults for everything inside template
 			user overrides
 				- ~/.pdk/pct.yml
 				- user customizations for their preferences
+			Environment overrides
+				- PCT_VALUE_<KEY> environment variables, eg. PCT_VALUE_PUPPET_MODULE__AUTHOR
 			Workspace overrides
 			  - ${cwd}/pct.yml
 				- ${outputDir}/pct.yml
+			Recorded values
+				- info.RecordedValues, the values content was generated with, eg. by pct update
+			Values files
+				- info.ValueFiles, eg. --values file.yml
+				- each file overrides the ones before it
+			Set values
+				- info.SetValues, eg. --set puppet_module.author=acme
+			Deployment values
+				- info.Values
+				- values supplied directly for this deployment, eg. replayed from a manifest
+			Computed values
+				- the template's computed section, evaluated with everything above
 	*/
+	setDefault := func(key string, value interface{}, source string) {
+		v.SetDefault(key, value)
+		sources[key] = source
+	}
+	merge := func(values map[string]interface{}, source string) {
+		if len(values) == 0 {
+			return
+		}
+		if err := v.MergeConfigMap(values); err != nil {
+			log.Warn().Msgf("Unable to merge %s values: %s", source, err.Error())
+			return
+		}
+		flattened := make(map[string]interface{})
+		flattenValues("", values, flattened)
+		for key := range flattened {
+			sources[strings.ToLower(key)] = source
+		}
+	}
 
 	// Convention based variables
-	v.SetDefault("pct_name", info.TargetName)
+	setDefault("pct_name", info.TargetName, "convention")
 
 	user := p.getCurrentUser()
-	v.SetDefault("user", user)
-	v.SetDefault("puppet_module.author", user)
+	setDefault("user", user, "convention")
+	setDefault("puppet_module.author", user, "convention")
 
 	// Machine based variables
 	cwd, _ := os.Getwd()
 	hostName, _ := p.OsUtils.Hostname()
-	v.SetDefault("cwd", cwd)
-	v.SetDefault("hostname", hostName)
+	setDefault("cwd", cwd, "machine")
+	setDefault("hostname", hostName, "machine")
+
+	// Git variables
+	gitValues := make(map[string]interface{})
+	flattenValues("", p.gitValues(info.TargetOutputDir), gitValues)
+	for key, value := range gitValues {
+		setDefault(key, value, "git")
+	}
 
 	// PDK binary specific variables
-	v.SetDefault("pdk.version", info.PdkInfo.Version)
-	v.SetDefault("pdk.commit_hash", info.PdkInfo.Commit)
-	v.SetDefault("pdk.build_date", info.PdkInfo.BuildDate)
+	setDefault("pdk.version", info.PdkInfo.Version, "pct")
+	setDefault("pdk.commit_hash", info.PdkInfo.Commit, "pct")
+	setDefault("pdk.build_date", info.PdkInfo.BuildDate, "pct")
+
+	// Module variables, which the template's own values override
+	moduleValues := make(map[string]interface{})
+	flattenValues("", p.moduleValues(tmpl, info.TargetOutputDir), moduleValues)
+	for key, value := range moduleValues {
+		setDefault(key, value, "module "+ModuleMetadataFileName)
+	}
 
 	// Template specific variables
+	for _, param := range tmpl.Parameters {
+		if param.Default != nil {
+			setDefault(strings.ToLower(param.Name), param.Default, "template parameter default")
+		}
+	}
 
 	configFile := filepath.Join(info.TemplateDirPath, TemplateConfigFileName)
-	log.Trace().Msgf("Adding %v", filepath.Dir(configFile))
-	// v.SetConfigFile(configFile)
-	v.SetConfigName(TemplateConfigName)
-	v.SetConfigType("yml")
-	v.AddConfigPath(filepath.Dir(configFile))
-	if err := v.ReadInConfig(); err == nil {
-		log.Trace().Msgf("Merging config file: %v", v.ConfigFileUsed())
+	log.Trace().Msgf("Adding %v", configFile)
+	vTemplate := viper.New()
+	vTemplate.SetFs(p.AFS)
+	vTemplate.SetConfigFile(configFile)
+	if err := vTemplate.ReadInConfig(); err == nil {
+		log.Trace().Msgf("Merging config file: %v", vTemplate.ConfigFileUsed())
 	} else {
 		log.Error().Msgf("Error reading config: %v", err)
 	}
+	merge(vTemplate.AllSettings(), "template "+configFile)
 
 	// User specified variable overrides
 	home, _ := p.Utils.Dir()
 	userConfigPath := filepath.Join(home, ".pdk")
 	log.Trace().Msgf("Adding %v", userConfigPath)
 	vUser := viper.New()
+	vUser.SetFs(p.AFS)
 	vUser.SetConfigName(UserTemplateConfigName)
 	vUser.SetConfigType("yml")
 	vUser.AddConfigPath(userConfigPath)
 	if err := vUser.ReadInConfig(); err == nil {
-		log.Trace().Msgf("Merging config file: %v", v.ConfigFileUsed())
+		log.Trace().Msgf("Merging config file: %v", vUser.ConfigFileUsed())
 	} else {
 		log.Debug().Msgf("Error reading config: %v", err)
 	}
+	merge(vUser.AllSettings(), "user "+vUser.ConfigFileUsed())
+
+	// Environment overrides, typed by the values they override
+	merge(p.environmentValues(tmpl, v), "environment")
 
 	// workspace overrides
 	vWorkspace := viper.New()
+	vWorkspace.SetFs(p.AFS)
 	vWorkspace.SetConfigName(UserTemplateConfigName)
 	vWorkspace.SetConfigType("yml")
 	vWorkspace.AddConfigPath(info.TargetOutputDir)
 	if err := vWorkspace.ReadInConfig(); err == nil {
-		log.Trace().Msgf("Merging config file: %v", v.ConfigFileUsed())
+		log.Trace().Msgf("Merging config file: %v", vWorkspace.ConfigFileUsed())
 	} else {
 		log.Debug().Msgf("Error reading config: %v", err)
 	}
-
-	userMergeErr := v.MergeConfigMap(vUser.AllSettings())
-	if userMergeErr != nil {
-		log.Warn().Msgf("Unable to merge user configuration values: %s", userMergeErr.Error())
+	merge(vWorkspace.AllSettings(), "workspace "+vWorkspace.ConfigFileUsed())
+	merge(withoutTemplateInfo(info.RecordedValues), "manifest")
+
+	for _, file := range info.ValueFiles {
+		vFile := viper.New()
+		vFile.SetFs(p.AFS)
+		vFile.SetConfigFile(file)
+		if filepath.Ext(file) == "" {
+			vFile.SetConfigType("yml")
+		}
+		if err := vFile.ReadInConfig(); err != nil {
+			return nil, nil, fmt.Errorf("Unable to read values file '%s': %v", file, err)
+		}
+		log.Trace().Msgf("Merging values file: %v", file)
+		merge(vFile.AllSettings(), "values file "+file)
 	}
-	workspaceMergeErr := v.MergeConfigMap(vWorkspace.AllSettings())
-	if userMergeErr != nil {
-		log.Warn().Msgf("Unable to merge workspace configuration values: %s", workspaceMergeErr.Error())
+	if len(info.SetValues) > 0 {
+		setValues, err := ParseSetValues(info.SetValues)
+		if err != nil {
+			return nil, nil, err
+		}
+		typeNumericValues(tmpl, setValues)
+		merge(setValues, "--set")
 	}
+	merge(info.Values, "deployment")
 
 	config := make(map[string]interface{})
 	err := v.Unmarshal(&config)
 	if err != nil {
 		log.Error().Msgf("unable to decode into struct, %v", err)
-		return nil
+		return nil, nil, err
+	}
+	for _, section := range reservedConfigSections {
+		delete(config, section)
 	}
 
-	return config
+	// Computed values are derived from everything else, so come last
+	if err := computeValues(tmpl, config, info.Strict || tmpl.Strict); err != nil {
+		return nil, nil, err
+	}
+	computed := make(map[string]interface{})
+	flattenValues("", tmpl.Computed, computed)
+	for name := range computed {
+		sources[strings.ToLower(name)] = "computed"
+	}
+
+	logValueSources(config, sources)
+
+	return config, sources, nil
+}
+
+// environmentValues collects template values from PCT_VALUE_ environment
+// variables. A double underscore in the variable name separates nested keys, so
+// PCT_VALUE_PUPPET_MODULE__AUTHOR sets puppet_module.author. Each value is
+// converted to the type of the parameter it sets or the value it overrides, and
+// is otherwise kept as a string.
+func (p *Pct) environmentValues(tmpl PuppetContentTemplateInfo, current *viper.Viper) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, env := range p.OsUtils.Environ() {
+		name, value, found := strings.Cut(env, "=")
+		if !found || !strings.HasPrefix(name, EnvironmentValuePrefix) {
+			continue
+		}
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, EnvironmentValuePrefix), "__", "."))
+		if !validValueKey(key) {
+			log.Warn().Msgf("Ignoring %s: not a valid value name", name)
+			continue
+		}
+
+		valueType := ParameterTypeString
+		if existing := current.Get(key); existing != nil {
+			valueType = inferParameterType(existing)
+		}
+		for _, param := range tmpl.Parameters {
+			if strings.EqualFold(param.Name, key) && param.Type != "" {
+				valueType = param.Type
+			}
+		}
+
+		log.Trace().Msgf("Using %s for '%s'", name, key)
+		setValue(values, key, parseAnswer(value, valueType))
+	}
+	return values
+}
+
+// logValueSources reports where each resolved value came from at debug level
+func logValueSources(config map[string]interface{}, sources map[string]string) {
+	flattened := make(map[string]interface{})
+	flattenValues("", config, flattened)
+
+	var keys []string
+	for key := range flattened {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		source, ok := sources[key]
+		if !ok {
+			source = "unknown"
+		}
+		log.Debug().Msgf("Value %s = %v (from %s)", key, flattened[key], source)
+	}
 }
 
 func (p *Pct) readTemplateConfig(configFile string) PuppetContentTemplateInfo {
@@ -501,47 +1274,60 @@ func (p *Pct) readTemplateConfig(configFile string) PuppetContentTemplateInfo {
 	}
 	// remove the known structure, leaving the unknown...
 	delete(all, "template")
+	for _, section := range reservedConfigSections {
+		delete(all, section)
+	}
+	// parameter defaults are defaults like any other
+	for _, param := range config.Parameters {
+		if _, ok := lookupValue(all, param.Name); !ok && param.Default != nil && param.Name != "" {
+			setValue(all, param.Name, param.Default)
+		}
+	}
 	// store the unknown as part of the big config
 	config.Defaults = all
 
 	return config
 }
 
-func (p *Pct) renderFile(fileName string, vars interface{}) (string, error) {
-	renderedTmpl := template.
-		New(filepath.Base(fileName)).
-		Funcs(
-			template.FuncMap{
-				"toClassName": func(itemName string) string {
-					return strings.Title(strings.ToLower(itemName))
-				},
-			},
-		)
-	// This is not ideal, but this function needs to be toggled
-	// if we are running with aferos in memory file system
-	// if the file doesnt exist on the os then check if its part of afero
-	tmpl, err := renderedTmpl.ParseFiles(fileName)
-	if os.IsNotExist(err) {
-		tmpl, err = renderedTmpl.ParseFS(p.IOFS, fileName)
+// renderFile parses a file, less any front matter and with the given
+// delimiters, into a copy of the template's partials and renders it with vars.
+// Errors in the file are RenderErrors positioned within the file as written,
+// front matter included.
+func (p *Pct) renderFile(fileName string, delimiters []string, partials *template.Template, vars interface{}) (string, error) {
+	content, err := p.AFS.ReadFile(fileName)
+	if err != nil {
+		log.Error().Msgf("Error reading template: %v", err)
+		return "", err
+	}
 
-		if err != nil {
-			log.Error().Msgf("Error parsing config: %v", err)
-			return "", err
-		}
+	set, err := partials.Clone()
+	if err != nil {
+		return "", err
+	}
+	_, body := splitFrontMatter(content)
+	offset := bytes.Count(content[:len(content)-len(body)], []byte("\n"))
+	tmpl, err := set.New(filepath.Base(fileName)).Delims(delims(delimiters)).Parse(string(body))
+	if err != nil {
+		log.Error().Msgf("Error parsing config: %v", err)
+		return "", newRenderError(fileName, err).withLineOffset(offset)
 	}
+	allowOptionalValues(tmpl)
 
-	return p.process(tmpl, vars), nil
+	text, err := p.process(tmpl, vars)
+	if err != nil {
+		return "", newRenderError(fileName, err).withLineOffset(offset)
+	}
+	return text, nil
 }
 
-func (p *Pct) process(t *template.Template, vars interface{}) string {
+func (p *Pct) process(t *template.Template, vars interface{}) (string, error) {
 	var tmplBytes bytes.Buffer
 
 	err := t.Execute(&tmplBytes, vars)
 	if err != nil {
-		log.Error().Msgf("Error parsing config: %v", err)
-		return ""
+		return "", err
 	}
-	return tmplBytes.String()
+	return tmplBytes.String(), nil
 }
 
 func (p *Pct) FilterFiles(ss []PuppetContentTemplate, test func(PuppetContentTemplate) bool) (ret []PuppetContentTemplate) {
@@ -1,12 +1,19 @@
 package pct_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/user"
 	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/puppetlabs/pct/internal/pkg/pct"
 	"github.com/puppetlabs/pct/pkg/install"
@@ -24,19 +31,42 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// newTestPct returns a Pct working in wd over an empty in-memory filesystem,
+// along with the filesystem
+func newTestPct(wd string) (*pct.Pct, *afero.Afero) {
+	fs := afero.NewMemMapFs()
+	afs := &afero.Afero{Fs: fs}
+	return &pct.Pct{
+		OsUtils: &mock.OsUtil{WD: wd},
+		Utils:   &mock.UtilsHelper{TestDir: wd},
+		AFS:     afs,
+		IOFS:    &afero.IOFS{Fs: fs},
+	}, afs
+}
+
+// checksum returns the SHA-256 a manifest records for content
+func checksum(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
 func TestDeploy(t *testing.T) {
 	type args struct {
 		info            pct.DeployInfo
 		templateConfig  string
 		templateContent map[string]string
+		existingFiles   map[string]string
+		promptInput     string
 	}
 
 	tmp := t.TempDir()
 
 	tests := []struct {
-		name string
-		args args
-		want []string
+		name        string
+		args        args
+		want        []pct.DeployedFile
+		wantErr     bool
+		wantBackups []string
 	}{
 		{
 			name: "deploy a project and return the correct new files",
@@ -62,9 +92,9 @@ template:
 					"metadata.json": "fixed string content",
 				},
 			},
-			want: []string{
-				filepath.Join(tmp, "foobar", "woo"),
-				filepath.Join(tmp, "foobar", "woo", "metadata.json"),
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "foobar", "woo"), Action: pct.DeployActionCreate},
+				{Path: filepath.Join(tmp, "foobar", "woo", "metadata.json"), Action: pct.DeployActionCreate},
 			},
 		},
 		{
@@ -91,9 +121,9 @@ template:
 					"metadata.json": "fixed string content",
 				},
 			},
-			want: []string{
-				tmp,
-				filepath.Join(tmp, "metadata.json"),
+			want: []pct.DeployedFile{
+				{Path: tmp, Action: pct.DeployActionCreate},
+				{Path: filepath.Join(tmp, "metadata.json"), Action: pct.DeployActionCreate},
 			},
 		},
 		{
@@ -120,9 +150,9 @@ template:
 					"metadata.json": "fixed string content",
 				},
 			},
-			want: []string{
-				filepath.Join(tmp, "wibble"),
-				filepath.Join(tmp, "wibble", "metadata.json"),
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "wibble"), Action: pct.DeployActionCreate},
+				{Path: filepath.Join(tmp, "wibble", "metadata.json"), Action: pct.DeployActionCreate},
 			},
 		},
 		{
@@ -151,9 +181,9 @@ template:
 Summary: {{.example_replace.summary}}`,
 				},
 			},
-			want: []string{
-				filepath.Join(tmp, "thing"),
-				filepath.Join(tmp, "thing", "woo.txt"),
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "thing"), Action: pct.DeployActionCreate},
+				{Path: filepath.Join(tmp, "thing", "woo.txt"), Action: pct.DeployActionCreate},
 			},
 		},
 		{
@@ -182,9 +212,9 @@ template:
 Summary: {{.example_replace.summary}}`,
 				},
 			},
-			want: []string{
-				tmp,
-				filepath.Join(tmp, filepath.Base(tmp)+".txt"),
+			want: []pct.DeployedFile{
+				{Path: tmp, Action: pct.DeployActionCreate},
+				{Path: filepath.Join(tmp, filepath.Base(tmp)+".txt"), Action: pct.DeployActionCreate},
 			},
 		},
 		{
@@ -213,10 +243,270 @@ template:
 Summary: {{.example_replace.summary}}`,
 				},
 			},
-			want: []string{
-				tmp,
-				filepath.Join(tmp, "wibble.txt"),
+			want: []pct.DeployedFile{
+				{Path: tmp, Action: pct.DeployActionCreate},
+				{Path: filepath.Join(tmp, "wibble.txt"), Action: pct.DeployActionCreate},
+			},
+		},
+		{
+			name: "dry run a project into an empty directory",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "dryrun"),
+					TargetName:       "woo",
+					DryRun:           true,
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+				},
+			},
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "dryrun", "woo"), Action: pct.DeployActionCreate, DryRun: true},
+				{Path: filepath.Join(tmp, "dryrun", "woo", "metadata.json"), Action: pct.DeployActionCreate, DryRun: true},
+			},
+		},
+		{
+			name: "dry run a project over existing files",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "dryrun"),
+					TargetName:       "woo",
+					DryRun:           true,
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+					"README.md":     "a new readme",
+				},
+				existingFiles: map[string]string{
+					filepath.Join(tmp, "dryrun", "woo", "metadata.json"): "fixed string content",
+					filepath.Join(tmp, "dryrun", "woo", "README.md"):     "an old readme",
+				},
+			},
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "dryrun", "woo"), Action: pct.DeployActionUnchanged, DryRun: true},
+				{Path: filepath.Join(tmp, "dryrun", "woo", "README.md"), Action: pct.DeployActionOverwrite, DryRun: true},
+				{Path: filepath.Join(tmp, "dryrun", "woo", "metadata.json"), Action: pct.DeployActionUnchanged, DryRun: true},
+			},
+		},
+		{
+			name: "skip existing files with the skip conflict policy",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "conflict"),
+					TargetName:       "woo",
+					OnConflict:       "skip",
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+					"README.md":     "a new readme",
+				},
+				existingFiles: map[string]string{
+					filepath.Join(tmp, "conflict", "woo", "README.md"): "an old readme",
+				},
+			},
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "conflict", "woo"), Action: pct.DeployActionUnchanged},
+				{Path: filepath.Join(tmp, "conflict", "woo", "README.md"), Action: pct.DeployActionSkip},
+				{Path: filepath.Join(tmp, "conflict", "woo", "metadata.json"), Action: pct.DeployActionCreate},
+			},
+		},
+		{
+			name: "back up existing files with the backup conflict policy",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "conflict"),
+					TargetName:       "woo",
+					OnConflict:       "backup",
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+					"README.md":     "a new readme",
+				},
+				existingFiles: map[string]string{
+					filepath.Join(tmp, "conflict", "woo", "README.md"): "an old readme",
+				},
+			},
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "conflict", "woo"), Action: pct.DeployActionUnchanged},
+				{Path: filepath.Join(tmp, "conflict", "woo", "README.md"), Action: pct.DeployActionBackup},
+				{Path: filepath.Join(tmp, "conflict", "woo", "metadata.json"), Action: pct.DeployActionCreate},
+			},
+			wantBackups: []string{
+				filepath.Join(tmp, "conflict", "woo", "README.md"),
+			},
+		},
+		{
+			name: "fail on existing files with the fail conflict policy",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "conflict"),
+					TargetName:       "woo",
+					OnConflict:       "fail",
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+					"README.md":     "a new readme",
+				},
+				existingFiles: map[string]string{
+					filepath.Join(tmp, "conflict", "woo", "README.md"): "an old readme",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "report conflicts in a dry run with the fail conflict policy",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "conflict"),
+					TargetName:       "woo",
+					OnConflict:       "fail",
+					DryRun:           true,
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+					"README.md":     "a new readme",
+				},
+				existingFiles: map[string]string{
+					filepath.Join(tmp, "conflict", "woo", "README.md"): "an old readme",
+				},
+			},
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "conflict", "woo"), Action: pct.DeployActionUnchanged, DryRun: true},
+				{Path: filepath.Join(tmp, "conflict", "woo", "README.md"), Action: pct.DeployActionConflict, DryRun: true},
+				{Path: filepath.Join(tmp, "conflict", "woo", "metadata.json"), Action: pct.DeployActionCreate, DryRun: true},
+			},
+		},
+		{
+			name: "ask how to handle existing files with the prompt conflict policy",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "conflict"),
+					TargetName:       "woo",
+					OnConflict:       "prompt",
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+					"README.md":     "a new readme",
+				},
+				existingFiles: map[string]string{
+					filepath.Join(tmp, "conflict", "woo", "README.md"): "an old readme",
+				},
+				promptInput: "maybe\nskip\n",
+			},
+			want: []pct.DeployedFile{
+				{Path: filepath.Join(tmp, "conflict", "woo"), Action: pct.DeployActionUnchanged},
+				{Path: filepath.Join(tmp, "conflict", "woo", "README.md"), Action: pct.DeployActionSkip},
+				{Path: filepath.Join(tmp, "conflict", "woo", "metadata.json"), Action: pct.DeployActionCreate},
+			},
+		},
+		{
+			name: "abort when asked with the prompt conflict policy",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "conflict"),
+					TargetName:       "woo",
+					OnConflict:       "prompt",
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+					"README.md":     "a new readme",
+				},
+				existingFiles: map[string]string{
+					filepath.Join(tmp, "conflict", "woo", "README.md"): "an old readme",
+				},
+				promptInput: "a\n",
+			},
+			wantErr: true,
+		},
+		{
+			name: "reject unknown conflict policies",
+			args: args{
+				info: pct.DeployInfo{
+					SelectedTemplate: "full-project",
+					TemplateDirPath:  "templates/author/id/0.1.0",
+					TargetOutputDir:  filepath.Join(tmp, "conflict"),
+					TargetName:       "woo",
+					OnConflict:       "sometimes",
+				},
+				templateConfig: `---
+template:
+  id: full-project
+  type: project
+
+`,
+				templateContent: map[string]string{
+					"metadata.json": "fixed string content",
+					"README.md":     "a new readme",
+				},
+				existingFiles: map[string]string{
+					filepath.Join(tmp, "conflict", "woo", "README.md"): "an old readme",
+				},
 			},
+			wantErr: true,
 		},
 	}
 
@@ -237,21 +527,1766 @@ Summary: {{.example_replace.summary}}`,
 				nf, _ := afs.Create(filepath.Join(contentDir, file))
 				nf.Write([]byte(content)) //nolint:errcheck
 			}
+			// Create any pre-existing target files
+			for file, content := range tt.args.existingFiles {
+				afs.WriteFile(file, []byte(content), 0640) //nolint:errcheck
+			}
 
 			p := &pct.Pct{
-				&mock.OsUtil{WD: tmp},
-				&mock.UtilsHelper{TestDir: tmp},
-				afs,
-				iofs,
+				OsUtils:  &mock.OsUtil{WD: tmp},
+				Utils:    &mock.UtilsHelper{TestDir: tmp},
+				AFS:      afs,
+				IOFS:     iofs,
+				Prompter: &pct.Prompter{In: strings.NewReader(tt.args.promptInput), Out: ioutil.Discard},
 			}
 
-			if got := p.Deploy(tt.args.info); !reflect.DeepEqual(got, tt.want) {
+			got, err := p.Deploy(tt.args.info)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Deploy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Deploy() = %v, want %v", got, tt.want)
 			}
+
+			for _, file := range tt.wantBackups {
+				backup, _ := afs.ReadFile(file + pct.BackupFileSuffix)
+				assert.Equal(t, tt.args.existingFiles[file], string(backup))
+			}
+
+			if tt.args.info.DryRun {
+				for _, d := range tt.want {
+					if exists, _ := afs.Exists(d.Path); d.Action == pct.DeployActionCreate && exists {
+						t.Errorf("Deploy() wrote %v during a dry run", d.Path)
+					}
+				}
+				for file, original := range tt.args.existingFiles {
+					if content, _ := afs.ReadFile(file); string(content) != original {
+						t.Errorf("Deploy() modified %v during a dry run", file)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDeployVerbatimFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+	}{
+		{
+			name:    "binary content",
+			file:    "logo.png",
+			content: []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0x00, 0x00, 0x0d, 0xff, 0xfe},
+		},
+		{
+			name:    "non UTF-8 content",
+			file:    "latin1.txt",
+			content: []byte("caf\xe9 cr\xe8me br\xfbl\xe9e\n"),
+		},
+		{
+			name:    "literal template delimiters",
+			file:    "workflow.yml",
+			content: []byte("run: echo ${{ github.sha }} {{ .not_a_value }}\n"),
+		},
+		{
+			name:    "an empty file",
+			file:    "empty.txt",
+			content: []byte{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			templateDir := "templates/author/id/0.1.0"
+
+			p, afs := newTestPct(tmp)
+			afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  id: id\n  type: item\n"), 0640) //nolint:errcheck
+			afs.WriteFile(filepath.Join(templateDir, "content", "files", tt.file), tt.content, 0640)                              //nolint:errcheck
+
+			info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp}
+			target := filepath.Join(tmp, "files", tt.file)
+
+			deployed, err := p.Deploy(info)
+			assert.NoError(t, err)
+			assert.Contains(t, deployed, pct.DeployedFile{Path: target, Action: pct.DeployActionCreate})
+
+			content, err := afs.ReadFile(target)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.content, content)
+
+			// deploying again recognises the identical content
+			info.DryRun = true
+			deployed, err = p.Deploy(info)
+			assert.NoError(t, err)
+			assert.Contains(t, deployed, pct.DeployedFile{Path: target, Action: pct.DeployActionUnchanged, DryRun: true})
+		})
+	}
+}
+
+func TestDeployFileModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		mode     os.FileMode
+		config   string
+		wantMode os.FileMode
+	}{
+		{
+			name:     "executable template",
+			file:     "scripts/bootstrap.sh.tmpl",
+			mode:     0755,
+			wantMode: 0755,
+		},
+		{
+			name:     "executable verbatim file",
+			file:     "tasks/init.sh",
+			mode:     0750,
+			wantMode: 0750,
+		},
+		{
+			name:     "private file",
+			file:     "secret.txt",
+			mode:     0600,
+			wantMode: 0600,
+		},
+		{
+			name:     "mode overridden in pct-config.yml",
+			file:     "tasks/init.sh",
+			mode:     0644,
+			config:   "files:\n  - glob: \"tasks/*.sh\"\n    mode: \"0755\"\n",
+			wantMode: 0755,
+		},
+		{
+			name:     "override glob without the template extension",
+			file:     "scripts/bootstrap.sh.tmpl",
+			mode:     0644,
+			config:   "files:\n  - glob: \"scripts/bootstrap.sh\"\n    mode: \"0700\"\n",
+			wantMode: 0700,
+		},
+		{
+			name:     "invalid override is ignored",
+			file:     "tasks/init.sh",
+			mode:     0644,
+			config:   "files:\n  - glob: \"tasks/*.sh\"\n    mode: \"rwx\"\n",
+			wantMode: 0644,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			templateDir := "templates/author/id/0.1.0"
+
+			p, afs := newTestPct(tmp)
+			source := filepath.Join(templateDir, "content", tt.file)
+			afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  id: id\n  type: item\n"+tt.config), 0640) //nolint:errcheck
+			afs.WriteFile(source, []byte("#!/bin/sh\n"), tt.mode)                                                                           //nolint:errcheck
+			afs.Chmod(source, tt.mode)                                                                                                      //nolint:errcheck
+
+			info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp}
+			target := filepath.Join(tmp, strings.TrimSuffix(tt.file, pct.TemplateFileExtension))
+
+			_, err := p.Deploy(info)
+			assert.NoError(t, err)
+
+			stat, err := afs.Stat(target)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantMode, stat.Mode().Perm())
+			}
+
+			// a target with the wrong mode is reported as needing an overwrite
+			afs.Chmod(target, 0640) //nolint:errcheck
+			info.DryRun = true
+			deployed, err := p.Deploy(info)
+			assert.NoError(t, err)
+			if tt.wantMode != 0640 {
+				assert.Contains(t, deployed, pct.DeployedFile{Path: target, Action: pct.DeployActionOverwrite, DryRun: true})
+			}
 		})
 	}
 }
 
+func TestDeployParameters(t *testing.T) {
+	parameters := `parameters:
+  - name: module_name
+    type: string
+    pattern: "^[a-z][a-z0-9_]*$"
+    required: true
+  - name: puppet_module.platforms
+    type: list
+    default: [RedHat]
+    min: 1
+  - name: port
+    type: integer
+    default: 8080
+    min: 1
+    max: 65535
+  - name: ensure
+    enum: [present, absent]
+`
+	tests := []struct {
+		name     string
+		values   map[string]interface{}
+		wantErr  string
+		wantFile string
+	}{
+		{
+			name:     "valid values with defaults",
+			values:   map[string]interface{}{"module_name": "ntp"},
+			wantFile: "ntp 8080",
+		},
+		{
+			name:    "missing required value",
+			values:  map[string]interface{}{},
+			wantErr: "Invalid template values:\n  * module_name: a value is required",
+		},
+		{
+			name: "every invalid value is reported",
+			values: map[string]interface{}{
+				"module_name":   "NTP-module",
+				"port":          70000,
+				"ensure":        "running",
+				"puppet_module": map[string]interface{}{"platforms": []interface{}{}},
+			},
+			wantErr: "Invalid template values:\n" +
+				"  * ensure: running must be one of: present, absent\n" +
+				"  * module_name: 'NTP-module' does not match pattern '^[a-z][a-z0-9_]*$'\n" +
+				"  * port: value 70000 is greater than the maximum of 65535\n" +
+				"  * puppet_module.platforms: length 0 is less than the minimum of 1",
+		},
+		{
+			name:    "wrong type",
+			values:  map[string]interface{}{"module_name": "ntp", "port": "http"},
+			wantErr: "Invalid template values:\n  * port: must be of type integer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			templateDir := "templates/author/id/0.1.0"
+
+			p, afs := newTestPct(tmp)
+			afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\n"+parameters), 0640) //nolint:errcheck
+			afs.WriteFile(filepath.Join(templateDir, "content", "file.txt.tmpl"), []byte("{{ .module_name }} {{ .port }}"), 0640)                              //nolint:errcheck
+
+			info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp, Values: tt.values}
+			_, err := p.Deploy(info)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Equal(t, tt.wantErr, err.Error())
+				}
+				exists, _ := afs.Exists(filepath.Join(tmp, "file.txt"))
+				assert.False(t, exists, "nothing should be deployed")
+				return
+			}
+			assert.NoError(t, err)
+
+			manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+			assert.NoError(t, err)
+			entry, _ := manifest.FindEntry("author", "id")
+			assert.Equal(t, checksum(tt.wantFile), entry.Files["file.txt"])
+
+			// parameter defaults are shown alongside the template's other defaults
+			tmplInfo, err := p.GetInfo(templateDir)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 8080, tmplInfo.Defaults["port"])
+			assert.Equal(t, map[string]interface{}{"platforms": []interface{}{"RedHat"}}, tmplInfo.Defaults["puppet_module"])
+		})
+	}
+}
+
+func TestPromptParameters(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		input      string
+		want       map[string]interface{}
+		wantOutput []string
+		wantErr    bool
+	}{
+		{
+			name: "parameters are asked for in order and validated",
+			config: `parameters:
+  - name: module_name
+    description: The module name
+    type: string
+    pattern: "^[a-z]+$"
+    required: true
+  - name: puppet_module.platforms
+    type: list
+    default: [RedHat, Debian]
+  - name: port
+    type: integer
+    default: 8080
+  - name: ensure
+    enum: [present, absent]
+`,
+			input: "\nNTP\nntp\n\nninety\n9090\nabsent\n",
+			want: map[string]interface{}{
+				"module_name": "ntp",
+				"port":        9090,
+				"ensure":      "absent",
+			},
+			wantOutput: []string{
+				"The module name (module_name): ",
+				"puppet_module.platforms [RedHat, Debian]: ",
+				"port [8080]: ",
+				"ensure {present, absent}: ",
+			},
+		},
+		{
+			name: "lists are answered as comma separated items",
+			config: `parameters:
+  - name: platforms
+    type: list
+`,
+			input: "RedHat, Debian\n",
+			want:  map[string]interface{}{"platforms": []interface{}{"RedHat", "Debian"}},
+		},
+		{
+			name: "templates without parameters are asked for their defaults",
+			config: `foo: bar
+nested:
+  enabled: true
+`,
+			input: "baz\nfalse\n",
+			want: map[string]interface{}{
+				"foo":    "baz",
+				"nested": map[string]interface{}{"enabled": false},
+			},
+			wantOutput: []string{"foo [bar]: ", "nested.enabled [true]: "},
+		},
+		{
+			name: "running out of answers is an error",
+			config: `parameters:
+  - name: module_name
+    required: true
+`,
+			input:   "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			templateDir := "templates/author/id/0.1.0"
+
+			p, afs := newTestPct(tmp)
+			afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  id: id\n  type: item\n"+tt.config), 0640) //nolint:errcheck
+
+			out := &strings.Builder{}
+			p.Prompter = &pct.Prompter{In: strings.NewReader(tt.input), Out: out}
+
+			got, err := p.PromptParameters(pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			for _, o := range tt.wantOutput {
+				assert.Contains(t, out.String(), o)
+			}
+		})
+	}
+}
+
+func TestParseSetValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		sets    []string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "typed values",
+			sets: []string{"name=ntp", "enabled=true", "port=8080", "ratio=0.5", "platforms=[RedHat, Debian]", "quoted='8080'"},
+			want: map[string]interface{}{
+				"name":      "ntp",
+				"enabled":   true,
+				"port":      8080,
+				"ratio":     0.5,
+				"platforms": []interface{}{"RedHat", "Debian"},
+				"quoted":    "8080",
+			},
+		},
+		{
+			name: "numbers written differently are kept as text",
+			sets: []string{"version=1.10", "mode=0755", "exponent=1e3", "negative=-2"},
+			want: map[string]interface{}{"version": "1.10", "mode": "0755", "exponent": "1e3", "negative": -2},
+		},
+		{
+			name: "dotted keys",
+			sets: []string{"puppet_module.author=acme", "puppet_module.license=Apache-2.0"},
+			want: map[string]interface{}{
+				"puppet_module": map[string]interface{}{"author": "acme", "license": "Apache-2.0"},
+			},
+		},
+		{
+			name: "values containing equals and empty values",
+			sets: []string{"url=https://example.com/?a=b", "empty="},
+			want: map[string]interface{}{"url": "https://example.com/?a=b", "empty": ""},
+		},
+		{
+			name: "later values win",
+			sets: []string{"name=first", "name=second"},
+			want: map[string]interface{}{"name": "second"},
+		},
+		{name: "missing equals", sets: []string{"name"}, wantErr: true},
+		{name: "missing key", sets: []string{"=value"}, wantErr: true},
+		{name: "empty key segment", sets: []string{"puppet_module..author=acme"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pct.ParseSetValues(tt.sets)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDeployValueOverrides(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+template_value: template
+file_value: template
+set_value: template
+deploy_value: template
+puppet_module:
+  license: template
+parameters:
+  - name: ratio
+    type: number
+`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "{{pct_name}}.pp"), []byte("content"), 0640)                      //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "file.txt"), []byte("content"), 0640)                             //nolint:errcheck
+	afs.WriteFile(filepath.Join(tmp, "first.yml"), []byte("file_value: first\nset_value: first\n"), 0640)                 //nolint:errcheck
+	afs.WriteFile(filepath.Join(tmp, "second.yml"), []byte("file_value: second\npuppet_module:\n  author: file\n"), 0640) //nolint:errcheck
+
+	info := pct.DeployInfo{
+		TemplateDirPath: templateDir,
+		TargetOutputDir: tmp,
+		ValueFiles:      []string{filepath.Join(tmp, "first.yml"), filepath.Join(tmp, "second.yml")},
+		SetValues:       []string{"set_value=set", "deploy_value=set", "puppet_module.author=acme", "enabled=true", "version=1.10", "ratio=1.10"},
+		Values:          map[string]interface{}{"deploy_value": "deploy"},
+	}
+	_, err := p.Deploy(info)
+	assert.NoError(t, err)
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("author", "id")
+	// the template's own values aren't recorded
+	assert.NotContains(t, entry.Values, "template_value")
+	assert.Equal(t, "second", entry.Values["file_value"])
+	assert.Equal(t, "set", entry.Values["set_value"])
+	assert.Equal(t, "deploy", entry.Values["deploy_value"])
+	assert.Equal(t, true, entry.Values["enabled"])
+	// only parameters declared as numbers are converted however they are written
+	assert.Equal(t, "1.10", entry.Values["version"])
+	assert.Equal(t, 1.1, entry.Values["ratio"])
+	assert.Equal(t, map[interface{}]interface{}{"author": "acme"}, entry.Values["puppet_module"])
+
+	// a set pct_name also renames the deployment
+	info.SetValues = []string{"pct_name=renamed"}
+	info.ValueFiles = nil
+	info.Values = nil
+	info.DryRun = true
+	deployed, err := p.Deploy(info)
+	assert.NoError(t, err)
+	assert.Contains(t, deployed, pct.DeployedFile{Path: filepath.Join(tmp, "renamed.pp"), Action: pct.DeployActionCreate, DryRun: true})
+
+	info.ValueFiles = []string{filepath.Join(tmp, "missing.yml")}
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, "Unable to read values file")
+
+	info.ValueFiles = nil
+	info.SetValues = []string{"invalid"}
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, "Invalid value 'invalid', expected key=value")
+}
+
+func TestDeployEnvironmentValues(t *testing.T) {
+	tmp := t.TempDir()
+	home := filepath.Join(tmp, "home")
+	target := filepath.Join(tmp, "target")
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+parameters:
+  - name: version
+    type: string
+enabled: false
+port: 8080
+ratio: 0.5
+platforms: [RedHat]
+user_value: template
+workspace_value: template
+`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "values.txt.tmpl"), []byte(`{{ printf "%v %T %v %T %v %T %v %T %v %T" .enabled .enabled .port .port .ratio .ratio .version .version .untyped .untyped }}
+{{ .platforms }} {{ .puppet_module.author }} {{ .user_value }} {{ .workspace_value }} {{ index . "broken" }}`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(home, ".pdk", "pct.yml"), []byte("user_value: user\n"), 0640)     //nolint:errcheck
+	afs.WriteFile(filepath.Join(target, "pct.yml"), []byte("workspace_value: workspace\n"), 0640) //nolint:errcheck
+
+	p.Utils = &mock.UtilsHelper{TestDir: tmp, Home: home}
+	p.OsUtils = &mock.OsUtil{WD: tmp, Env: []string{
+		"HOME=/home/user",
+		"PCT_VALUE_ENABLED=true",
+		"PCT_VALUE_PORT=9090",
+		"PCT_VALUE_RATIO=0.75",
+		"PCT_VALUE_PLATFORMS=RedHat,Debian",
+		"PCT_VALUE_VERSION=1.10",
+		"PCT_VALUE_UNTYPED=123",
+		"PCT_VALUE_PUPPET_MODULE__AUTHOR=acme",
+		"PCT_VALUE_USER_VALUE=environment",
+		"PCT_VALUE_WORKSPACE_VALUE=environment",
+		"PCT_VALUE_BROKEN__=ignored",
+	}}
+
+	_, err := p.Deploy(pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: target})
+	assert.NoError(t, err)
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(target))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("author", "id")
+	assert.Equal(t, checksum("true bool 9090 int 0.75 float64 1.10 string 123 string\n[RedHat Debian] acme environment workspace <no value>"), entry.Files["values.txt"])
+
+	// the environment is read again each time, so isn't recorded
+	assert.Equal(t, "workspace", entry.Values["workspace_value"])
+	for _, key := range []string{"enabled", "port", "ratio", "platforms", "version", "untyped", "puppet_module", "user_value"} {
+		assert.NotContains(t, entry.Values, key)
+	}
+}
+
+func TestDeployFileRules(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+include:
+  - glob: "spec/acceptance"
+    when: "{{ .acceptance_tests }}"
+exclude:
+  - glob: ".github"
+    when: eq .ci "none"
+  - glob: "*.md"
+    when: "{{ not .docs }}"
+acceptance_tests: false
+ci: github
+docs: true
+`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "spec", "acceptance", "init_spec.rb.tmpl"), []byte("content"), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "spec", "unit", "init_spec.rb"), []byte("content"), 0640)            //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", ".github", "workflows", "ci.yml"), []byte("content"), 0640)          //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "README.md.tmpl"), []byte("content"), 0640)                          //nolint:errcheck
+
+	actions := func(deployed []pct.DeployedFile) map[string]string {
+		result := make(map[string]string)
+		for _, d := range deployed {
+			rel, _ := filepath.Rel(tmp, d.Path)
+			result[filepath.ToSlash(rel)] = d.Action
+		}
+		return result
+	}
+
+	info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp, DryRun: true}
+	deployed, err := p.Deploy(info)
+	assert.NoError(t, err)
+	got := actions(deployed)
+	assert.Equal(t, pct.DeployActionExclude, got["spec/acceptance"])
+	assert.Equal(t, pct.DeployActionExclude, got["spec/acceptance/init_spec.rb"])
+	assert.Equal(t, pct.DeployActionCreate, got["spec/unit/init_spec.rb"])
+	assert.Equal(t, pct.DeployActionCreate, got[".github/workflows/ci.yml"])
+	assert.Equal(t, pct.DeployActionCreate, got["README.md"])
+
+	info.DryRun = false
+	info.SetValues = []string{"acceptance_tests=true", "ci=none", "docs=false"}
+	deployed, err = p.Deploy(info)
+	assert.NoError(t, err)
+	got = actions(deployed)
+	assert.Equal(t, pct.DeployActionCreate, got["spec/acceptance/init_spec.rb"])
+	assert.Equal(t, pct.DeployActionExclude, got[".github"])
+	assert.Equal(t, pct.DeployActionExclude, got[".github/workflows/ci.yml"])
+	assert.Equal(t, pct.DeployActionExclude, got["README.md"])
+
+	exists, _ := afs.DirExists(filepath.Join(tmp, ".github"))
+	assert.False(t, exists)
+	manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("author", "id")
+	assert.NotContains(t, entry.Files, "README.md")
+	assert.NotContains(t, entry.Values, "include")
+
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  id: id\nexclude:\n  - glob: \"*\"\n    when: \"{{ len 1 }}\"\n"), 0640) //nolint:errcheck
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, "Unable to evaluate exclude rule for '*'")
+}
+
+func TestDeployHooks(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+hooks:
+  timeout: 2m
+  pre_deploy:
+    - git init
+  post_deploy:
+    - bundle install --path {{ .bundle_path }}
+    - pdk validate
+bundle_path: vendor/bundle
+`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "file.txt"), []byte("content"), 0640) //nolint:errcheck
+	tmpl, err := p.GetInfo(templateDir)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		info         pct.DeployInfo
+		failCommand  string
+		wantCommands []string
+		wantErr      string
+	}{
+		{
+			name: "hooks are not run by default",
+		},
+		{
+			name:         "hooks run when allowed",
+			info:         pct.DeployInfo{AllowHooks: true},
+			wantCommands: []string{"sh -c git init", "sh -c bundle install --path 'vendor/bundle'", "sh -c pdk validate"},
+		},
+		{
+			name:         "trusted hooks run",
+			info:         pct.DeployInfo{TrustedHooks: []string{"someone", pct.HooksDigest(tmpl)}},
+			wantCommands: []string{"sh -c git init", "sh -c bundle install --path 'vendor/bundle'", "sh -c pdk validate"},
+		},
+		{
+			name: "hooks are not trusted by author",
+			info: pct.DeployInfo{TrustedHooks: []string{"author"}},
+		},
+		{
+			name:         "values are quoted as a single argument",
+			info:         pct.DeployInfo{AllowHooks: true, SetValues: []string{"bundle_path=x'; rm -rf ~"}},
+			wantCommands: []string{"sh -c git init", `sh -c bundle install --path 'x'\''; rm -rf ~'`, "sh -c pdk validate"},
+		},
+		{
+			name: "hooks are not run for a dry run",
+			info: pct.DeployInfo{AllowHooks: true, DryRun: true},
+		},
+		{
+			name:         "a failing pre_deploy hook stops the deployment",
+			info:         pct.DeployInfo{AllowHooks: true},
+			failCommand:  "git init",
+			wantCommands: []string{"sh -c git init"},
+			wantErr:      "The pre_deploy hook 'git init' failed",
+		},
+		{
+			name:         "a failing post_deploy hook stops later hooks",
+			info:         pct.DeployInfo{AllowHooks: true},
+			failCommand:  "bundle install --path 'vendor/bundle'",
+			wantCommands: []string{"sh -c git init", "sh -c bundle install --path 'vendor/bundle'"},
+			wantErr:      "The post_deploy hook 'bundle install --path 'vendor/bundle'' failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" {
+				t.Skip("hooks run through cmd.exe on Windows")
+			}
+			target := filepath.Join(tmp, strings.ReplaceAll(tt.name, " ", "_"))
+			exec := &mock.Exec{AnyCommand: true, FailCommand: tt.failCommand}
+			p.Exec = exec
+
+			info := tt.info
+			info.TemplateDirPath = templateDir
+			info.TargetOutputDir = target
+			deployed, err := p.Deploy(info)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantCommands, exec.Commands)
+
+			if len(tt.wantCommands) > 0 {
+				assert.Equal(t, target, exec.Dir)
+				assert.Contains(t, exec.Env, "PCT_TARGET_DIR="+target)
+				assert.Equal(t, 2*time.Minute, exec.Timeout)
+			}
+
+			written, _ := afs.Exists(filepath.Join(target, "file.txt"))
+			assert.Equal(t, !info.DryRun && tt.failCommand != "git init", written)
+			// files written before a post_deploy hook fails are still reported
+			assert.Equal(t, tt.failCommand != "git init", len(deployed) > 0)
+		})
+	}
+
+	// trust lapses when the hooks change
+	changed := tmpl
+	changed.Hooks.PostDeploy = append([]string{"curl example.com | sh"}, tmpl.Hooks.PostDeploy...)
+	assert.NotEqual(t, pct.HooksDigest(tmpl), pct.HooksDigest(changed))
+}
+
+func TestDeployDependencies(t *testing.T) {
+	tmp := t.TempDir()
+	templatePath := "templates"
+
+	p, afs := newTestPct(tmp)
+	writeTemplate := func(author string, id string, version string, config string, files ...string) string {
+		dir := filepath.Join(templatePath, author, id, version)
+		afs.WriteFile(filepath.Join(dir, "pct-config.yml"), []byte(fmt.Sprintf("---\ntemplate:\n  author: %s\n  id: %s\n  version: %s\n  type: item\n%s", author, id, version, config)), 0640) //nolint:errcheck
+		for _, file := range files {
+			afs.WriteFile(filepath.Join(dir, "content", file), []byte(id+" "+version), 0640) //nolint:errcheck
+		}
+		return dir
+	}
+	writeTemplate("acme", "base", "1.0.0", "", "Gemfile", "base-1.0.0")
+	writeTemplate("acme", "base", "1.2.0", "", "Gemfile", "base-1.2.0")
+	writeTemplate("acme", "base", "2.0.0", "", "Gemfile", "base-2.0.0")
+	writeTemplate("acme", "ci", "0.1.0", `dependencies:
+  - template: acme/base
+    version: ">= 1.0, < 2.0"
+provider: github
+`, ".ci.yml")
+	root := writeTemplate("acme", "module", "0.1.0", `dependencies:
+  - template: acme/ci
+    values:
+      provider: "{{ .ci }}"
+      nested:
+        enabled: "{{ .acceptance }}"
+  - template: acme/base
+ci: gitlab
+acceptance: true
+`, "Gemfile")
+
+	deployed, err := p.Deploy(pct.DeployInfo{TemplateDirPath: root, TargetOutputDir: tmp})
+	assert.NoError(t, err)
+	var order []string
+	for _, d := range deployed {
+		rel, _ := filepath.Rel(tmp, d.Path)
+		order = append(order, rel+" "+d.Action)
+	}
+	assert.Equal(t, []string{
+		". create", "Gemfile create", "base-1.2.0 create",
+		". unchanged", ".ci.yml create",
+		". unchanged", "Gemfile overwrite",
+	}, order)
+
+	content, _ := afs.ReadFile(filepath.Join(tmp, "Gemfile"))
+	assert.Equal(t, "module 0.1.0", string(content))
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("acme", "ci")
+	assert.Equal(t, "gitlab", entry.Values["provider"])
+	assert.Equal(t, true, entry.Values["nested"].(map[interface{}]interface{})["enabled"])
+	assert.True(t, entry.Dependency)
+	entry, _ = manifest.FindEntry("acme", "base")
+	assert.Equal(t, "1.2.0", entry.Version)
+	assert.True(t, entry.Dependency)
+	entry, _ = manifest.FindEntry("acme", "module")
+	assert.False(t, entry.Dependency)
+
+	// a template deployed in its own right isn't replayed as a dependency
+	_, err = p.Deploy(pct.DeployInfo{TemplateDirPath: filepath.Join(templatePath, "acme", "base", "1.2.0"), TargetOutputDir: tmp, TargetName: filepath.Base(tmp), OnConflict: pct.ConflictPolicyOverwrite})
+	assert.NoError(t, err)
+	_, err = p.Deploy(pct.DeployInfo{TemplateDirPath: root, TargetOutputDir: tmp, OnConflict: pct.ConflictPolicyOverwrite})
+	assert.NoError(t, err)
+	manifest, _ = p.ReadManifest(pct.ManifestPath(tmp))
+	entry, _ = manifest.FindEntry("acme", "base")
+	assert.False(t, entry.Dependency)
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "missing dependency",
+			config:  "dependencies:\n  - template: acme/missing\n",
+			wantErr: "'acme/missing' is not installed",
+		},
+		{
+			name:    "unsatisfied constraint",
+			config:  "dependencies:\n  - template: acme/base\n    version: \">= 3.0\"\n",
+			wantErr: "no installed version of 'acme/base' satisfies '>= 3.0' (installed: 1.0.0, 1.2.0, 2.0.0)",
+		},
+		{
+			name:    "invalid name",
+			config:  "dependencies:\n  - template: base\n",
+			wantErr: "dependency 'base' must be in AUTHOR/ID format",
+		},
+		{
+			name:    "cycle",
+			config:  "dependencies:\n  - template: acme/cycle\n",
+			wantErr: "Template dependency cycle detected: acme/cycle -> acme/cycle",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTemplate("acme", "cycle", "0.1.0", tt.config, "file")
+			_, err := p.Deploy(pct.DeployInfo{TemplateDirPath: dir, TargetOutputDir: filepath.Join(tmp, "cycle")})
+			assert.ErrorContains(t, err, tt.wantErr)
+			exists, _ := afs.Exists(filepath.Join(tmp, "cycle", "file"))
+			assert.False(t, exists)
+		})
+	}
+}
+
+func TestDeployPartials(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\nholder: Acme\n"), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "partials", "license_header.tmpl"), []byte("# Copyright {{ .holder }}\n"), 0640)                             //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "partials", "ruby", "helpers"), []byte(`{{ define "frozen" }}# frozen_string_literal: true{{ end }}`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "init.pp.tmpl"), []byte(`{{ template "license_header" . }}class {{ .pct_name }} {}`), 0640)       //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "spec.rb.tmpl"), []byte(`{{ template "frozen" }}`), 0640)                                         //nolint:errcheck
+
+	_, err := p.Deploy(pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp, TargetName: "module"})
+	assert.NoError(t, err)
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("author", "id")
+	assert.Equal(t, checksum("# Copyright Acme\nclass module {}"), entry.Files["init.pp"])
+	assert.Equal(t, checksum("# frozen_string_literal: true"), entry.Files["spec.rb"])
+	assert.NotContains(t, entry.Files, "license_header")
+
+	assert.NoError(t, pct.CheckPartials(afs, templateDir, pct.PuppetContentTemplateInfo{}))
+
+	afs.WriteFile(filepath.Join(templateDir, "content", "README.md.tmpl"), []byte(`{{ if .docs }}{{ template "readme_header" . }}{{ end }}`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "partials", "footer.tmpl"), []byte(`{{ template "missing_footer" }}`), 0640)                           //nolint:errcheck
+	err = pct.CheckPartials(afs, templateDir, pct.PuppetContentTemplateInfo{})
+	assert.EqualError(t, err, "Missing partials:\n  * content/README.md.tmpl: readme_header\n  * partials/footer: missing_footer")
+
+	afs.WriteFile(filepath.Join(templateDir, "partials", "broken.tmpl"), []byte(`{{ if }}`), 0640) //nolint:errcheck
+	_, err = p.Deploy(pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp})
+	assert.ErrorContains(t, err, "Unable to parse partial 'broken'")
+}
+
+func TestDeployDelimiters(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+delimiters: ["[[", "]]"]
+files:
+  - glob: "*.erb"
+    delimiters: ["<<", ">>"]
+holder: Acme
+`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "partials", "header.tmpl"), []byte("# [[ .holder ]]\n"), 0640)                                    //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "chart.yaml.tmpl"), []byte(`[[ template "header" . ]]name: {{ .Values.name }}`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "motd.erb.tmpl"), []byte(`<< .holder >> <%= [[ x ]] %>`), 0640)                        //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "{{ .holder }}.md.tmpl"), []byte(`[[ .holder ]]`), 0640)                               //nolint:errcheck
+
+	_, err := p.Deploy(pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp})
+	assert.NoError(t, err)
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("author", "id")
+	assert.Equal(t, map[string]string{
+		"chart.yaml": checksum("# Acme\nname: {{ .Values.name }}"),
+		"motd.erb":   checksum("Acme <%= [[ x ]] %>"),
+		"Acme.md":    checksum("Acme"),
+	}, entry.Files)
+
+	tmpl, err := p.GetInfo(templateDir)
+	assert.NoError(t, err)
+	assert.NoError(t, pct.CheckPartials(afs, templateDir, tmpl))
+	afs.WriteFile(filepath.Join(templateDir, "content", "motd.erb.tmpl"), []byte(`<< template "footer" >>`), 0640) //nolint:errcheck
+	assert.EqualError(t, pct.CheckPartials(afs, templateDir, tmpl), "Missing partials:\n  * content/motd.erb.tmpl: footer")
+
+	tmpl.Files[0].Delimiters = []string{"<<"}
+	assert.EqualError(t, pct.ValidateDelimiters(tmpl), `Delimiters must be a left and a right delimiter, eg ['[[', ']]'], not ["<<"] for '*.erb'`)
+}
+
+func TestDeployRenderedPaths(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+class_name: widget
+task_name: RunTask
+acceptance: false
+`), 0640) //nolint:errcheck
+	for _, file := range []string{
+		"manifests/{{ .class_name }}.pp.tmpl",
+		"tasks/{{ .task_name | snake }}.json",
+		"spec/{{pct_name}}_spec.rb",
+		"spec/{{ if .acceptance }}acceptance{{ end }}/init_spec.rb",
+		"{{ .license_file }}",
+		"README.md.tmpl",
+	} {
+		afs.WriteFile(filepath.Join(templateDir, "content", file), []byte("content"), 0640) //nolint:errcheck
+	}
+
+	info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp, TargetName: "module", DryRun: true}
+	deployed, err := p.Deploy(info)
+	assert.NoError(t, err)
+	var paths []string
+	for _, d := range deployed {
+		rel, _ := filepath.Rel(tmp, d.Path)
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	assert.ElementsMatch(t, []string{
+		".", "README.md", "manifests", "manifests/widget.pp", "spec", "spec/module_spec.rb", "tasks", "tasks/run_task.json",
+	}, paths)
+
+	info.SetValues = []string{"acceptance=true", "class_name=../../escape"}
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, "The path 'manifests/{{ .class_name }}.pp.tmpl' renders to")
+	assert.ErrorContains(t, err, "which is outside of the target directory")
+
+	info.SetValues = []string{"acceptance=true"}
+	deployed, err = p.Deploy(info)
+	assert.NoError(t, err)
+	assert.Contains(t, deployed, pct.DeployedFile{Path: filepath.Join(tmp, "spec", "acceptance", "init_spec.rb"), Action: pct.DeployActionCreate, DryRun: true})
+
+	// a path only partly rendered from a missing value is an error, not skipped
+	info.SetValues = nil
+	afs.WriteFile(filepath.Join(templateDir, "content", "manifests", "{{ .clas_name }}.pp.tmpl"), []byte("content"), 0640) //nolint:errcheck
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, "Unable to render the path 'manifests/{{ .clas_name }}.pp.tmpl': it uses a value that is not set")
+	afs.Remove(filepath.Join(templateDir, "content", "manifests", "{{ .clas_name }}.pp.tmpl")) //nolint:errcheck
+
+	// strict deployments fail rather than skip paths using missing values
+	info.Strict = true
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, "Unable to render the path '{{ .license_file }}'")
+	assert.ErrorContains(t, err, `map has no entry for key "license_file"`)
+}
+
+func TestDeployIgnore(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+ignore:
+  - "*.orig"
+  - spec/fixtures/
+  - "!keep.orig"
+`), 0640) //nolint:errcheck
+	for _, file := range []string{"init.pp.tmpl", "init.pp.orig", "keep.orig", "spec/fixtures/modules/stdlib.pp", "spec/init_spec.rb"} {
+		afs.WriteFile(filepath.Join(templateDir, "content", file), []byte("content"), 0640) //nolint:errcheck
+	}
+
+	deployed, err := p.Deploy(pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp, DryRun: true})
+	assert.NoError(t, err)
+	var paths []string
+	for _, d := range deployed {
+		rel, _ := filepath.Rel(tmp, d.Path)
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	assert.ElementsMatch(t, []string{".", "init.pp", "keep.orig", "spec", "spec/init_spec.rb"}, paths)
+}
+
+// failingFs fails to open a single file for writing
+type failingFs struct {
+	afero.Fs
+	fail string
+}
+
+func (f *failingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if filepath.Base(name) == f.fail && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, fmt.Errorf("disk full")
+	}
+	return f.Fs.OpenFile(name, flag, perm)
+}
+
+// hookExec writes into the directory each hook runs in, as hooks such as git init
+// do
+type hookExec struct {
+	mock.Exec
+	afs *afero.Afero
+}
+
+func (e *hookExec) Run() error {
+	if err := e.Exec.Run(); err != nil {
+		return err
+	}
+	return e.afs.WriteFile(filepath.Join(e.Dir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0640)
+}
+
+func TestDeployRollback(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+	target := filepath.Join(tmp, "module")
+
+	mem := afero.NewMemMapFs()
+	fs := &failingFs{Fs: mem}
+	afs := &afero.Afero{Fs: fs}
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\n"), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "a_existing.txt"), []byte("new"), 0640)                                             //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "b_dir", "created.txt"), []byte("created"), 0640)                                   //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "c_failing.txt"), []byte("content"), 0640)                                          //nolint:errcheck
+	afs.WriteFile(filepath.Join(target, "a_existing.txt"), []byte("original"), 0600)                                                        //nolint:errcheck
+
+	p := &pct.Pct{
+		OsUtils: &mock.OsUtil{WD: tmp},
+		Utils:   &mock.UtilsHelper{TestDir: tmp},
+		AFS:     afs,
+		IOFS:    &afero.IOFS{Fs: fs},
+	}
+	info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: target, OnConflict: pct.ConflictPolicyBackup}
+
+	fs.fail = "c_failing.txt"
+	_, err := p.Deploy(info)
+	assert.ErrorContains(t, err, "Unable to deploy '"+filepath.Join(target, "c_failing.txt")+"': disk full")
+
+	content, _ := afs.ReadFile(filepath.Join(target, "a_existing.txt"))
+	assert.Equal(t, "original", string(content))
+	stat, _ := afs.Stat(filepath.Join(target, "a_existing.txt"))
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	for _, removed := range []string{"a_existing.txt" + pct.BackupFileSuffix, "b_dir", ".pct"} {
+		exists, _ := afs.Exists(filepath.Join(target, removed))
+		assert.False(t, exists, removed)
+	}
+
+	// a deployment into a new directory removes the directory
+	fs.fail = "c_failing.txt"
+	info.TargetOutputDir = filepath.Join(tmp, "new", "module")
+	_, err = p.Deploy(info)
+	assert.Error(t, err)
+	exists, _ := afs.Exists(filepath.Join(tmp, "new"))
+	assert.False(t, exists)
+
+	// so does one whose pre_deploy hooks ran in the new directory
+	if runtime.GOOS != "windows" {
+		afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\nhooks:\n  pre_deploy:\n    - git init\n"), 0640) //nolint:errcheck
+		exec := &hookExec{Exec: mock.Exec{AnyCommand: true}, afs: afs}
+		p.Exec = exec
+		hooked := info
+		hooked.AllowHooks = true
+		hooked.TargetOutputDir = filepath.Join(tmp, "hooked", "module")
+		fs.fail = "c_failing.txt"
+		_, err = p.Deploy(hooked)
+		assert.Error(t, err)
+		assert.Len(t, exec.Commands, 1)
+		exists, _ = afs.Exists(filepath.Join(tmp, "hooked"))
+		assert.False(t, exists)
+	}
+
+	// a file that fails to render stops the deployment before anything is written
+	fs.fail = ""
+	afs.WriteFile(filepath.Join(templateDir, "content", "d_broken.txt.tmpl"), []byte(`{{ required "a license is required" .license }}`), 0640) //nolint:errcheck
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, "Unable to render the template:\n  * "+filepath.Join(templateDir, "content", "d_broken.txt.tmpl"))
+	assert.ErrorContains(t, err, "a license is required")
+	exists, _ = afs.Exists(filepath.Join(tmp, "new"))
+	assert.False(t, exists)
+
+	// content that can't be read stops the deployment before anything is written
+	afs.RemoveAll(filepath.Join(templateDir, "content")) //nolint:errcheck
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, filepath.Join(templateDir, "content"))
+	exists, _ = afs.Exists(filepath.Join(tmp, "new"))
+	assert.False(t, exists)
+}
+
+func TestDeployStrict(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\nholder: Acme\n"), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "partials", "header.tmpl"), []byte("# Copyright {{ .holder }}\n# {{ .licence }}\n"), 0640)                   //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "a.txt.tmpl"), []byte("{{ .holder }}\n  {{ .hodler }}"), 0640)                                    //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "b.txt.tmpl"), []byte(`{{ template "header" . }}`), 0640)                                         //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "c.txt.tmpl"), []byte(`{{ index . "optional" | default "none" }}`), 0640)                         //nolint:errcheck
+
+	info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp, DryRun: true}
+
+	_, err := p.Deploy(info)
+	assert.NoError(t, err)
+
+	expected := pct.RenderErrors{
+		{File: filepath.Join(templateDir, "content", "a.txt.tmpl"), Line: 2, Column: 5, Message: `executing "a.txt.tmpl" at <.hodler>: map has no entry for key "hodler"`},
+		{File: filepath.Join(templateDir, "content", "b.txt.tmpl"), Partial: "header", Line: 2, Column: 5, Message: `executing "header" at <.licence>: map has no entry for key "licence"`},
+	}
+
+	info.Strict = true
+	_, err = p.Deploy(info)
+	var renderErrors pct.RenderErrors
+	assert.ErrorAs(t, err, &renderErrors)
+	assert.Equal(t, expected, renderErrors)
+	assert.EqualError(t, err, fmt.Sprintf("Unable to render the template:\n  * %s:2:5: %s\n  * %s: partial 'header':2:5: %s",
+		expected[0].File, expected[0].Message, expected[1].File, expected[1].Message))
+
+	// the template can make itself strict
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\nstrict: true\nholder: Acme\n"), 0640) //nolint:errcheck
+	info.Strict = false
+	_, err = p.Deploy(info)
+	assert.ErrorAs(t, err, &renderErrors)
+	assert.Equal(t, expected, renderErrors)
+
+	tmpl, err := p.GetInfo(templateDir)
+	assert.NoError(t, err)
+	assert.True(t, tmpl.Strict)
+	assert.NotContains(t, tmpl.Defaults, "strict")
+
+	// errors that aren't tied to a position are still reported against their file
+	afs.WriteFile(filepath.Join(templateDir, "content", "a.txt.tmpl"), []byte("{{ if }}"), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "partials", "header.tmpl"), []byte(""), 0640)       //nolint:errcheck
+	_, err = p.Deploy(info)
+	assert.ErrorAs(t, err, &renderErrors)
+	assert.Equal(t, pct.RenderErrors{{File: filepath.Join(templateDir, "content", "a.txt.tmpl"), Line: 1, Message: "missing value for if"}}, renderErrors)
+
+	// positions count the lines of any front matter
+	afs.WriteFile(filepath.Join(templateDir, "content", "a.txt.tmpl"), []byte("---\nforeach: items\n---\n{{ .holder }}\n  {{ .hodler }}"), 0640)                                      //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\nstrict: true\nholder: Acme\nitems: [one]\n"), 0640) //nolint:errcheck
+	_, err = p.Deploy(info)
+	assert.ErrorAs(t, err, &renderErrors)
+	assert.Equal(t, pct.RenderErrors{
+		{File: filepath.Join(templateDir, "content", "a.txt.tmpl"), Line: 5, Column: 5, Message: `executing "a.txt.tmpl" at <.hodler>: map has no entry for key "hodler"`},
+	}, renderErrors)
+
+	// default and required still handle missing values
+	afs.WriteFile(filepath.Join(templateDir, "content", "a.txt.tmpl"), []byte(`{{ .license | default "MIT" }} {{ default "none" $.puppet_module.summary }}`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "b.txt.tmpl"), []byte(`{{ .owner | required "an owner is required" }}`), 0640)                              //nolint:errcheck
+	_, err = p.Deploy(info)
+	assert.ErrorAs(t, err, &renderErrors)
+	if assert.Len(t, renderErrors, 1) {
+		assert.Equal(t, filepath.Join(templateDir, "content", "b.txt.tmpl"), renderErrors[0].File)
+		assert.Contains(t, renderErrors[0].Message, "an owner is required")
+	}
+
+	info.DryRun = false
+	info.SetValues = []string{"owner=me"}
+	_, err = p.Deploy(info)
+	assert.NoError(t, err)
+	manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	assert.Equal(t, checksum("MIT none"), manifest.Templates[0].Files["a.txt"])
+	assert.Equal(t, checksum("me"), manifest.Templates[0].Files["b.txt"])
+}
+
+func TestDeployForeach(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+files:
+  - glob: "manifests/role/*"
+    foreach: roles
+profiles:
+  - web
+  - db
+roles:
+  - name: frontend
+    profiles: [web]
+`), 0640) //nolint:errcheck
+	profile := filepath.Join(templateDir, "content", "manifests", "profile", "{{item}}.pp.tmpl")
+	afs.WriteFile(profile, []byte("---\nforeach: profiles\n---\nclass profile::{{ .item }} {}"), 0640)                                          //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "manifests", "role", "{{ .item.name }}.pp.tmpl"), []byte("{{ .item.profiles }}"), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "data", "common.yaml.tmpl"), []byte("---\nprofiles: {{ .profiles }}\n---\n"), 0640)     //nolint:errcheck
+
+	info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp}
+
+	deployed, err := p.Deploy(info)
+	assert.NoError(t, err)
+	var paths []string
+	for _, d := range deployed {
+		paths = append(paths, d.Path)
+	}
+	assert.Equal(t, []string{
+		tmp,
+		filepath.Join(tmp, "data"),
+		filepath.Join(tmp, "data", "common.yaml"),
+		filepath.Join(tmp, "manifests"),
+		filepath.Join(tmp, "manifests", "profile"),
+		filepath.Join(tmp, "manifests", "profile", "web.pp"),
+		filepath.Join(tmp, "manifests", "profile", "db.pp"),
+		filepath.Join(tmp, "manifests", "role"),
+		filepath.Join(tmp, "manifests", "role", "frontend.pp"),
+	}, paths)
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("author", "id")
+	assert.Equal(t, checksum("class profile::web {}"), entry.Files["manifests/profile/web.pp"])
+	assert.Equal(t, checksum("class profile::db {}"), entry.Files["manifests/profile/db.pp"])
+	assert.Equal(t, checksum("[web]"), entry.Files["manifests/role/frontend.pp"])
+	assert.Equal(t, checksum("---\nprofiles: [web db]\n---\n"), entry.Files["data/common.yaml"])
+
+	// an empty list deploys nothing
+	info.DryRun = true
+	info.Values = map[string]interface{}{"profiles": []interface{}{}}
+	deployed, err = p.Deploy(info)
+	assert.NoError(t, err)
+	for _, d := range deployed {
+		assert.NotRegexp(t, `profile.+\.pp$`, d.Path)
+	}
+
+	info.Values = map[string]interface{}{"profiles": "web"}
+	_, err = p.Deploy(info)
+	assert.EqualError(t, err, fmt.Sprintf("Unable to expand '%s': The foreach value 'profiles' must be a list, not string", profile))
+
+	info.Values = map[string]interface{}{"profiles": []interface{}{"web", "db", "web"}}
+	_, err = p.Deploy(info)
+	assert.EqualError(t, err, fmt.Sprintf("More than one file would be deployed to the same target:\n  * %s: %s, %s",
+		filepath.Join(tmp, "manifests", "profile", "web.pp"), profile, profile))
+}
+
+func TestDeployComputed(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+module_name: acme-widget
+computed:
+  class_name: "{{ .module_name | replace \"-\" \"_\" }}"
+  spec_file: "{{ .class_name }}_spec.rb"
+  puppet_module.summary: "The {{ $.class_name }} module"
+`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "manifests", "{{ .class_name }}.pp.tmpl"), []byte("class {{ .class_name }} {}"), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "spec", "{{ .spec_file }}.tmpl"), []byte("{{ .puppet_module.summary }}"), 0640)        //nolint:errcheck
+
+	info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp}
+
+	_, err := p.Deploy(info)
+	assert.NoError(t, err)
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("author", "id")
+	assert.Equal(t, checksum("class acme_widget {}"), entry.Files["manifests/acme_widget.pp"])
+	assert.Equal(t, checksum("The acme_widget module"), entry.Files["spec/acme_widget_spec.rb"])
+
+	// computed values are evaluated after every override
+	info.SetValues = []string{"module_name=other", "class_name=ignored"}
+	deployed, err := p.Deploy(info)
+	assert.NoError(t, err)
+	assert.Contains(t, deployed, pct.DeployedFile{Path: filepath.Join(tmp, "manifests", "other.pp"), Action: pct.DeployActionCreate})
+
+	tmpl, err := p.GetInfo(templateDir)
+	assert.NoError(t, err)
+	assert.NotContains(t, tmpl.Defaults, "computed")
+
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+computed:
+  a: "{{ .b }}"
+  b: "{{ if .c }}{{ end }}"
+  c: "{{ .a }}"
+`), 0640) //nolint:errcheck
+	_, err = p.Deploy(info)
+	assert.EqualError(t, err, "Computed values depend on each other in a cycle: a -> b -> c -> a")
+
+	// computed values use the template's delimiters, and fail on missing values when strict
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  type: item
+delimiters: ["[[", "]]"]
+module_name: acme
+computed:
+  class_name: "[[ .module_name ]]"
+  summary: "[[ .modlue_name ]]"
+`), 0640) //nolint:errcheck
+	afs.RemoveAll(filepath.Join(templateDir, "content"))                                                    //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "init.pp.tmpl"), []byte("[[ .class_name ]]"), 0640) //nolint:errcheck
+	info.SetValues = nil
+	_, err = p.Deploy(info)
+	assert.NoError(t, err)
+	manifest, err = p.ReadManifest(pct.ManifestPath(tmp))
+	assert.NoError(t, err)
+	assert.Equal(t, checksum("acme"), manifest.Templates[0].Files["init.pp"])
+
+	info.Strict = true
+	_, err = p.Deploy(info)
+	assert.ErrorContains(t, err, "Unable to compute 'summary'")
+	assert.ErrorContains(t, err, `map has no entry for key "modlue_name"`)
+}
+
+func TestDeployModuleMetadata(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+	config := `---
+template:
+  author: author
+  id: id
+  type: %s
+puppet_module:
+  author: template-default
+`
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(fmt.Sprintf(config, "item")), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "class.pp.tmpl"), []byte(
+		`{{ .puppet_module.short_name }}::{{ .pct_name }} {{ .puppet_module.name }} {{ .puppet_module.author }} {{ .puppet_module.version }}`+
+			` {{ range .puppet_module.dependencies }}{{ .name }}{{ end }} {{ range .puppet_module.operatingsystem_support }}{{ .operatingsystem }}{{ end }}`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(tmp, "metadata.json"), []byte(`{
+  "name": "acme-widget",
+  "version": "1.2.3",
+  "author": "acme",
+  "dependencies": [{"name": "puppetlabs/stdlib", "version_requirement": ">= 9.0.0"}],
+  "operatingsystem_support": [{"operatingsystem": "RedHat"}, {"operatingsystem": "Debian"}]
+}`), 0640) //nolint:errcheck
+
+	deployedFile := func(info pct.DeployInfo) string {
+		_, err := p.Deploy(info)
+		assert.NoError(t, err)
+		manifest, err := p.ReadManifest(pct.ManifestPath(info.TargetOutputDir))
+		assert.NoError(t, err)
+		entry, _ := manifest.FindEntry("author", "id")
+		return entry.Files["class.pp"]
+	}
+
+	info := pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: tmp, TargetName: "server"}
+	// the template's own values take precedence over the module's
+	assert.Equal(t, checksum("widget::server acme-widget template-default 1.2.3 puppetlabs/stdlib RedHatDebian"), deployedFile(info))
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\n"), 0640) //nolint:errcheck
+	assert.Equal(t, checksum("widget::server acme-widget acme 1.2.3 puppetlabs/stdlib RedHatDebian"), deployedFile(info))
+
+	// values supplied by the user still take precedence
+	info.SetValues = []string{"puppet_module.author=someone"}
+	assert.Equal(t, checksum("widget::server acme-widget someone 1.2.3 puppetlabs/stdlib RedHatDebian"), deployedFile(info))
+	info.SetValues = nil
+
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(fmt.Sprintf(config, "item")), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(tmp, "metadata.json"), []byte("{"), 0640)                                  //nolint:errcheck
+	assert.Equal(t, checksum("<no value>::server <no value> template-default <no value>  "), deployedFile(info))
+
+	// project templates create a new module rather than add to one
+	afs.WriteFile(filepath.Join(tmp, "project", "metadata.json"), []byte(`{"name": "acme-widget"}`), 0640)    //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(fmt.Sprintf(config, "project")), 0640) //nolint:errcheck
+	info = pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: filepath.Join(tmp, "project")}
+	assert.Equal(t, checksum("<no value>::project <no value> template-default <no value>  "), deployedFile(info))
+}
+
+func TestDeployRootDetection(t *testing.T) {
+	tmp := t.TempDir()
+	templateDir := "templates/author/id/0.1.0"
+	config := "---\ntemplate:\n  author: author\n  id: id\n  type: %s\n"
+
+	tests := []struct {
+		name            string
+		templateType    string
+		markers         []string
+		wd              string
+		targetName      string
+		noRootDetection bool
+		expectedFile    string
+	}{
+		{
+			name:         "item templates deploy to the module root",
+			templateType: "item",
+			markers:      []string{"module/metadata.json"},
+			wd:           "module/manifests/profile",
+			targetName:   "widget",
+			expectedFile: "module/widget.pp",
+		},
+		{
+			name:         "the nearest root is used",
+			templateType: "item",
+			markers:      []string{"Puppetfile", "site-modules/profile/metadata.json"},
+			wd:           "site-modules/profile/manifests",
+			expectedFile: "site-modules/profile/profile.pp",
+		},
+		{
+			name:         "bolt projects are detected",
+			templateType: "item",
+			markers:      []string{"project/bolt-project.yaml"},
+			wd:           "project/plans",
+			targetName:   "deploy",
+			expectedFile: "project/deploy.pp",
+		},
+		{
+			name:         "content deployed by pct marks a root",
+			templateType: "item",
+			markers:      []string{"content/.pct/manifest.yml"},
+			wd:           "content/docs",
+			targetName:   "readme",
+			expectedFile: "content/readme.pp",
+		},
+		{
+			name:            "root detection can be turned off",
+			templateType:    "item",
+			markers:         []string{"module/metadata.json"},
+			wd:              "module/manifests",
+			targetName:      "widget",
+			noRootDetection: true,
+			expectedFile:    "module/manifests/widget.pp",
+		},
+		{
+			name:         "the working directory is used outside of a project",
+			templateType: "item",
+			wd:           "scratch",
+			targetName:   "widget",
+			expectedFile: "scratch/widget.pp",
+		},
+		{
+			name:         "project templates deploy to the working directory",
+			templateType: "project",
+			markers:      []string{"module/metadata.json"},
+			wd:           "module/manifests",
+			targetName:   "widget",
+			expectedFile: "module/manifests/widget/widget.pp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, afs := newTestPct(filepath.Join(tmp, tt.wd))
+			afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(fmt.Sprintf(config, tt.templateType)), 0640) //nolint:errcheck
+			afs.WriteFile(filepath.Join(templateDir, "content", "{{pct_name}}.pp"), []byte("content"), 0640)                //nolint:errcheck
+			for _, marker := range tt.markers {
+				afs.WriteFile(filepath.Join(tmp, marker), []byte("{}"), 0640) //nolint:errcheck
+			}
+
+			_, err := p.Deploy(pct.DeployInfo{TemplateDirPath: templateDir, TargetName: tt.targetName, NoRootDetection: tt.noRootDetection})
+			assert.NoError(t, err)
+			exists, _ := afs.Exists(filepath.Join(tmp, tt.expectedFile))
+			assert.True(t, exists, tt.expectedFile)
+		})
+	}
+}
+
+func TestDeployGitValues(t *testing.T) {
+	templateDir := "templates/author/id/0.1.0"
+	home := "/home/someone"
+	osUser, _ := user.Current()
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		wd       string
+		target   string
+		expected string
+		root     string
+	}{
+		{
+			name: "repository settings override the user's",
+			files: map[string]string{
+				"/home/someone/.config/git/config": "[user]\n\tname = Old Name\n",
+				"/home/someone/.gitconfig":         "[user]\n\tname = \"Some One\" # the full name\n\temail = someone@example.com\n",
+				"/src/widget/.git/config":          "[core]\n\tbare = false\n[user]\n\temail = work@example.com\n[remote \"origin\"]\n\turl = git@github.com:acme/widget.git\n\tfetch = +refs/heads/*:refs/remotes/origin/*\n",
+				"/src/widget/.git/HEAD":            "ref: refs/heads/feature/docs\n",
+			},
+			target:   "/src/widget/manifests",
+			expected: "Some One|work@example.com|git@github.com:acme/widget.git|feature/docs|",
+			root:     "/src/widget",
+		},
+		{
+			name: "the working directory is used when the target isn't in a repository",
+			files: map[string]string{
+				"/src/widget/.git/config": "[remote \"origin\"]\n\turl = https://github.com/acme/widget\n",
+				"/src/widget/.git/HEAD":   "4b825dc642cb6eb9a060e54bf8d69288fbee4904\n",
+			},
+			wd:       "/src/widget/manifests",
+			target:   "/tmp/output",
+			expected: osUser.Username + "||https://github.com/acme/widget||",
+			root:     "/src/widget",
+		},
+		{
+			name: "worktrees read the configuration of their repository",
+			files: map[string]string{
+				"/src/widget-docs/.git":                            "gitdir: ../widget/.git/worktrees/widget-docs\n",
+				"/src/widget/.git/worktrees/widget-docs/HEAD":      "ref: refs/heads/docs\n",
+				"/src/widget/.git/worktrees/widget-docs/commondir": "../..\n",
+				"/src/widget/.git/config":                          "[user]\n\tname = Some One\n",
+			},
+			target:   "/src/widget-docs",
+			expected: "Some One|||docs|",
+			root:     "/src/widget-docs",
+		},
+		{
+			name:     "values fall back without git",
+			target:   "/tmp/output",
+			expected: osUser.Username + "||||",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, afs := newTestPct(filepath.FromSlash(tt.wd))
+			p.Utils = &mock.UtilsHelper{Home: filepath.FromSlash(home)}
+			afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  author: author\n  id: id\n  type: item\n"), 0640) //nolint:errcheck
+			afs.WriteFile(filepath.Join(templateDir, "content", "git.txt.tmpl"), []byte(
+				"{{ .git.user.name }}|{{ .git.user.email }}|{{ .git.origin_url }}|{{ .git.branch }}|{{ .git.root }}"), 0640) //nolint:errcheck
+			for path, content := range tt.files {
+				afs.WriteFile(filepath.FromSlash(path), []byte(content), 0640) //nolint:errcheck
+			}
+
+			target := filepath.FromSlash(tt.target)
+			_, err := p.Deploy(pct.DeployInfo{TemplateDirPath: templateDir, TargetOutputDir: target})
+			assert.NoError(t, err)
+
+			manifest, err := p.ReadManifest(pct.ManifestPath(target))
+			assert.NoError(t, err)
+			entry, _ := manifest.FindEntry("author", "id")
+			expected := tt.expected + filepath.FromSlash(tt.root)
+			assert.Equal(t, checksum(expected), entry.Files["git.txt"], expected)
+		})
+	}
+}
+
+func TestDeployManifest(t *testing.T) {
+	tmp := t.TempDir()
+	target := filepath.Join(tmp, "project")
+	templateDir := "templates/author/id/0.1.0"
+
+	p, afs := newTestPct(tmp)
+	afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(`---
+template:
+  author: author
+  id: id
+  version: 0.1.0
+  type: project
+`), 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(templateDir, "content", "sub", "file.txt"), []byte("content"), 0640) //nolint:errcheck
+
+	info := pct.DeployInfo{
+		TemplateDirPath: templateDir,
+		TargetOutputDir: target,
+		PdkInfo:         pct.PDKInfo{Version: "1.2.3"},
+	}
+	_, err := p.Deploy(info)
+	assert.NoError(t, err)
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(target))
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Templates, 1)
+
+	entry, found := manifest.FindEntry("author", "id")
+	assert.True(t, found)
+	assert.Equal(t, "0.1.0", entry.Version)
+	assert.Equal(t, "project", entry.Name)
+	assert.Equal(t, "1.2.3", entry.PctVersion)
+	assert.Equal(t, "project", entry.Values["pct_name"])
+	// values found again each time, such as the machine's and git's, aren't recorded
+	for _, key := range []string{"cwd", "hostname", "user", "git", "pdk", "puppet_module"} {
+		assert.NotContains(t, entry.Values, key)
+	}
+	// sha256 of "content"
+	assert.Equal(t, map[string]string{
+		"sub/file.txt": "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+	}, entry.Files)
+
+	// replaying the recorded values redeploys under the recorded name
+	info.Values = entry.Values
+	info.TargetOutputDir = filepath.Join(tmp, "replayed")
+	deployed, err := p.Deploy(info)
+	assert.NoError(t, err)
+	assert.Contains(t, deployed, pct.DeployedFile{Path: filepath.Join(tmp, "replayed", "sub", "file.txt"), Action: pct.DeployActionCreate})
+
+	replayed, err := p.ReadManifest(pct.ManifestPath(filepath.Join(tmp, "replayed")))
+	assert.NoError(t, err)
+	assert.Equal(t, "project", replayed.Templates[0].Name)
+
+	// dry runs are not recorded
+	info.DryRun = true
+	info.TargetOutputDir = filepath.Join(tmp, "dryrun")
+	_, err = p.Deploy(info)
+	assert.NoError(t, err)
+	_, err = p.ReadManifest(pct.ManifestPath(filepath.Join(tmp, "dryrun")))
+	assert.Error(t, err)
+}
+
+func TestUpdate(t *testing.T) {
+	tmp := t.TempDir()
+	target := filepath.Join(tmp, "project")
+
+	templates := map[string]map[string]string{
+		"templates/author/id/0.1.0": {
+			"unchanged.txt": "same\n",
+			"upstream.txt":  "old\n",
+			"edited.txt":    "a\nb\nc\n",
+			"clash.txt":     "a\n",
+			"removed.txt":   "gone\n",
+		},
+		"templates/author/id/0.2.0": {
+			"unchanged.txt": "same\n",
+			"upstream.txt":  "new\n",
+			"edited.txt":    "a\nb\nc\nd\n",
+			"clash.txt":     "b\n",
+			"removed.txt":   "gone\n",
+			"added.txt":     "added\n",
+		},
+	}
+	working := map[string]string{
+		"unchanged.txt": "same\n",
+		"upstream.txt":  "old\n",
+		"edited.txt":    "A\nb\nc\n",
+		"clash.txt":     "c\n",
+	}
+
+	p, afs := newTestPct(tmp)
+	for templateDir, content := range templates {
+		afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  id: id\n  type: project\n"), 0640) //nolint:errcheck
+		for file, text := range content {
+			afs.WriteFile(filepath.Join(templateDir, "content", file+".tmpl"), []byte(text), 0640) //nolint:errcheck
+		}
+	}
+	for file, text := range working {
+		afs.WriteFile(filepath.Join(target, file), []byte(text), 0640) //nolint:errcheck
+	}
+
+	got, err := p.Update(pct.UpdateInfo{
+		DeployInfo: pct.DeployInfo{
+			TemplateDirPath: "templates/author/id/0.2.0",
+			TargetOutputDir: target,
+			DryRun:          true,
+		},
+		PreviousTemplateDirPath: "templates/author/id/0.1.0",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []pct.DeployedFile{
+		{Path: target, Action: pct.DeployActionUnchanged, DryRun: true},
+		{Path: filepath.Join(target, "added.txt"), Action: pct.DeployActionCreate, DryRun: true},
+		{Path: filepath.Join(target, "clash.txt"), Action: pct.DeployActionConflict, DryRun: true},
+		{Path: filepath.Join(target, "edited.txt"), Action: pct.DeployActionMerge, DryRun: true},
+		{Path: filepath.Join(target, "removed.txt"), Action: pct.DeployActionSkip, DryRun: true},
+		{Path: filepath.Join(target, "unchanged.txt"), Action: pct.DeployActionUnchanged, DryRun: true},
+		{Path: filepath.Join(target, "upstream.txt"), Action: pct.DeployActionOverwrite, DryRun: true},
+	}, got)
+
+	for file, text := range working {
+		content, _ := afs.ReadFile(filepath.Join(target, file))
+		assert.Equal(t, text, string(content), "dry run modified %s", file)
+	}
+
+	// both versions render with the values the content was generated with
+	afs.WriteFile(filepath.Join(target, "greeting.txt"), []byte("hi\n"), 0640) //nolint:errcheck
+	for templateDir := range templates {
+		afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte("---\ntemplate:\n  id: id\n  type: project\ngreeting: hello\n"), 0640) //nolint:errcheck
+		afs.WriteFile(filepath.Join(templateDir, "content", "greeting.txt.tmpl"), []byte("{{ .greeting }}\n"), 0640)                              //nolint:errcheck
+	}
+	afs.WriteFile(filepath.Join("templates/author/id/0.2.0", "content", "greeting.txt.tmpl"), []byte("{{ .greeting }}\n{{ .name }}\n"), 0640) //nolint:errcheck
+	got, err = p.Update(pct.UpdateInfo{
+		DeployInfo: pct.DeployInfo{
+			TemplateDirPath: "templates/author/id/0.2.0",
+			TargetOutputDir: target,
+			DryRun:          true,
+			RecordedValues:  map[string]interface{}{"greeting": "hi"},
+			SetValues:       []string{"name=someone"},
+		},
+		PreviousTemplateDirPath: "templates/author/id/0.1.0",
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, got, pct.DeployedFile{Path: filepath.Join(target, "greeting.txt"), Action: pct.DeployActionOverwrite, DryRun: true})
+
+	// files copied verbatim are compared by checksum and never merged
+	afs.WriteFile(filepath.Join("templates/author/id/0.1.0", "content", "logo.bin"), []byte{0x00, 0x01}, 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join("templates/author/id/0.2.0", "content", "logo.bin"), []byte{0x00, 0x02}, 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join("templates/author/id/0.1.0", "content", "data.bin"), []byte{0xff, 0x01}, 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join("templates/author/id/0.2.0", "content", "data.bin"), []byte{0xff, 0x02}, 0640) //nolint:errcheck
+	afs.WriteFile(filepath.Join(target, "logo.bin"), []byte{0x00, 0x01}, 0640)                                 //nolint:errcheck
+	afs.WriteFile(filepath.Join(target, "data.bin"), []byte{0xff, 0x03}, 0640)                                 //nolint:errcheck
+	got, err = p.Update(pct.UpdateInfo{
+		DeployInfo:              pct.DeployInfo{TemplateDirPath: "templates/author/id/0.2.0", TargetOutputDir: target},
+		PreviousTemplateDirPath: "templates/author/id/0.1.0",
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, got, pct.DeployedFile{Path: filepath.Join(target, "logo.bin"), Action: pct.DeployActionOverwrite})
+	assert.Contains(t, got, pct.DeployedFile{Path: filepath.Join(target, "data.bin"), Action: pct.DeployActionConflict})
+	content, _ := afs.ReadFile(filepath.Join(target, "logo.bin"))
+	assert.Equal(t, []byte{0x00, 0x02}, content)
+	content, _ = afs.ReadFile(filepath.Join(target, "data.bin"))
+	assert.Equal(t, []byte{0xff, 0x03}, content)
+
+	manifest, err := p.ReadManifest(pct.ManifestPath(target))
+	assert.NoError(t, err)
+	assert.Equal(t, checksum(string([]byte{0xff, 0x03})), manifest.Templates[0].Files["data.bin"])
+}
+
+func TestUpdateTemplateDefaults(t *testing.T) {
+	tmp := t.TempDir()
+	target := filepath.Join(tmp, "project")
+
+	p, afs := newTestPct(tmp)
+	for version, license := range map[string]string{"0.1.0": "MIT", "0.2.0": "Apache-2.0"} {
+		templateDir := filepath.Join("templates/author/id", version)
+		afs.WriteFile(filepath.Join(templateDir, "pct-config.yml"), []byte(fmt.Sprintf("---\ntemplate:\n  author: author\n  id: id\n  version: %s\n  type: project\nlicense: %s\n", version, license)), 0640) //nolint:errcheck
+		afs.WriteFile(filepath.Join(templateDir, "content", "about.txt.tmpl"), []byte("{{ .template.version }} {{ .license }}\n"), 0640)                                                                      //nolint:errcheck
+	}
+
+	_, err := p.Deploy(pct.DeployInfo{TemplateDirPath: "templates/author/id/0.1.0", TargetOutputDir: target})
+	assert.NoError(t, err)
+	manifest, err := p.ReadManifest(pct.ManifestPath(target))
+	assert.NoError(t, err)
+	entry, _ := manifest.FindEntry("author", "id")
+	// the template's own values are read from the version that renders
+	assert.NotContains(t, entry.Values, "template")
+	assert.NotContains(t, entry.Values, "license")
+	afs.WriteFile(filepath.Join(target, "about.txt"), []byte("0.1.0 MIT\n"), 0640) //nolint:errcheck
+
+	got, err := p.Update(pct.UpdateInfo{
+		DeployInfo: pct.DeployInfo{
+			TemplateDirPath: "templates/author/id/0.2.0",
+			TargetOutputDir: target,
+			// manifests written by earlier versions of pct recorded the template section
+			RecordedValues: map[string]interface{}{"pct_name": "project", "template": map[string]interface{}{"version": "0.1.0"}},
+		},
+		PreviousTemplateDirPath: "templates/author/id/0.1.0",
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, got, pct.DeployedFile{Path: filepath.Join(target, "about.txt"), Action: pct.DeployActionOverwrite})
+	manifest, err = p.ReadManifest(pct.ManifestPath(target))
+	assert.NoError(t, err)
+	assert.Equal(t, checksum("0.2.0 Apache-2.0\n"), manifest.Templates[0].Files["about.txt"])
+}
+
 func TestGet(t *testing.T) {
 	type args struct {
 		templateDirPath string
@@ -323,10 +2358,10 @@ template:
 			}
 
 			p := &pct.Pct{
-				&mock.OsUtil{},
-				&mock.UtilsHelper{},
-				afs,
-				iofs,
+				OsUtils: &mock.OsUtil{},
+				Utils:   &mock.UtilsHelper{},
+				AFS:     afs,
+				IOFS:    iofs,
 			}
 
 			got, err := p.Get(tt.args.templateDirPath)
@@ -417,10 +2452,10 @@ func TestDisplayDefaults(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			fs := afero.NewMemMapFs()
 			p := &pct.Pct{
-				&mock.OsUtil{},
-				&mock.UtilsHelper{},
-				&afero.Afero{Fs: fs},
-				&afero.IOFS{Fs: fs},
+				OsUtils: &mock.OsUtil{},
+				Utils:   &mock.UtilsHelper{},
+				AFS:     &afero.Afero{Fs: fs},
+				IOFS:    &afero.IOFS{Fs: fs},
 			}
 
 			returnString := p.DisplayDefaults(tt.args.defaults, tt.format)
@@ -780,10 +2815,10 @@ template:
 			}
 
 			p := &pct.Pct{
-				&mock.OsUtil{},
-				&mock.UtilsHelper{},
-				afs,
-				iofs,
+				OsUtils: &mock.OsUtil{},
+				Utils:   &mock.UtilsHelper{},
+				AFS:     afs,
+				IOFS:    iofs,
 			}
 
 			got := p.List(tt.args.templatePath, tt.args.templateName)
@@ -0,0 +1,192 @@
+package pct
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// PrompterI asks the user a question and returns their answer
+type PrompterI interface {
+	Ask(question string) (string, error)
+}
+
+// Prompter asks questions on Out and reads answers from In, one answer per line.
+// In can be any reader, which allows prompts to be scripted in tests.
+type Prompter struct {
+	In     io.Reader
+	Out    io.Writer
+	reader *bufio.Reader
+}
+
+func (p *Prompter) Ask(question string) (string, error) {
+	if p.reader == nil {
+		p.reader = bufio.NewReader(p.In)
+	}
+
+	fmt.Fprintf(p.Out, "%s ", question)
+	answer, err := p.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return "", err
+	}
+
+	return strings.TrimSpace(answer), nil
+}
+
+// PromptParameters asks for a value for each of a template's parameters, showing
+// the value the deployment would otherwise use as the default. Templates without
+// a parameters section are asked for each of their defaults instead. Answers are
+// validated as they are given, and only answered parameters are returned, ready
+// to be used as the deployment's Values.
+func (p *Pct) PromptParameters(info DeployInfo) (map[string]interface{}, error) {
+	if p.Prompter == nil {
+		return nil, fmt.Errorf("Unable to prompt for template values")
+	}
+
+	tmpl := p.readTemplateConfig(filepath.Join(info.TemplateDirPath, TemplateConfigFileName))
+	config, _, err := p.processConfiguration(info, tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	params := tmpl.Parameters
+	if len(params) == 0 {
+		params = inferParameters(tmpl.Defaults)
+	}
+
+	answers := make(map[string]interface{})
+	for _, param := range params {
+		current, _ := lookupValue(config, param.Name)
+		value, answered, err := p.promptParameter(param, current)
+		if err != nil {
+			return nil, err
+		}
+		if answered {
+			setValue(answers, param.Name, value)
+		}
+	}
+
+	return answers, nil
+}
+
+// promptParameter asks for a single parameter until a valid answer is given. An
+// empty answer keeps the current value, unless a required value is missing.
+func (p *Pct) promptParameter(param TemplateParameter, current interface{}) (interface{}, bool, error) {
+	label := param.Name
+	if param.Description != "" {
+		label = fmt.Sprintf("%s (%s)", param.Description, param.Name)
+	}
+	if len(param.Enum) > 0 {
+		var allowed []string
+		for _, e := range param.Enum {
+			allowed = append(allowed, fmt.Sprint(e))
+		}
+		label = fmt.Sprintf("%s {%s}", label, strings.Join(allowed, ", "))
+	}
+	question := label + ":"
+	if current != nil && current != "" {
+		question = fmt.Sprintf("%s [%s]:", label, formatAnswer(current))
+	}
+
+	for {
+		answer, err := p.Prompter.Ask(question)
+		if err != nil {
+			return nil, false, fmt.Errorf("Unable to read a value for '%s': %v", param.Name, err)
+		}
+
+		if answer == "" {
+			if param.Required && (current == nil || current == "") {
+				log.Warn().Msgf("A value is required for '%s'", param.Name)
+				continue
+			}
+			return nil, false, nil
+		}
+
+		value := parseAnswer(answer, param.Type)
+		if msg := param.check(value); msg != "" {
+			log.Warn().Msgf("Invalid value for '%s': %s", param.Name, msg)
+			continue
+		}
+		return value, true, nil
+	}
+}
+
+// inferParameters describes every leaf of a template's defaults as a parameter
+// typed by its default value
+func inferParameters(defaults map[string]interface{}) []TemplateParameter {
+	flattened := make(map[string]interface{})
+	flattenValues("", defaults, flattened)
+
+	var names []string
+	for name := range flattened {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var params []TemplateParameter
+	for _, name := range names {
+		params = append(params, TemplateParameter{Name: name, Type: inferParameterType(flattened[name])})
+	}
+	return params
+}
+
+func inferParameterType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return ParameterTypeBoolean
+	case []interface{}:
+		return ParameterTypeList
+	}
+	if n, ok := toFloat(value); ok {
+		if n == float64(int64(n)) {
+			return ParameterTypeInteger
+		}
+		return ParameterTypeNumber
+	}
+	return ParameterTypeString
+}
+
+// parseAnswer converts an answer into a value of the given type. Lists are
+// answered as comma separated items. Answers that cannot be converted are
+// returned as strings to be reported by validation.
+func parseAnswer(answer string, paramType string) interface{} {
+	switch paramType {
+	case ParameterTypeString:
+		return answer
+	case ParameterTypeInteger:
+		if n, err := strconv.Atoi(strings.TrimSpace(answer)); err == nil {
+			return n
+		}
+	case ParameterTypeNumber:
+		// A declared number is converted however it is written, eg 1.10
+		if n, err := strconv.ParseFloat(strings.TrimSpace(answer), 64); err == nil {
+			return n
+		}
+	case ParameterTypeList:
+		if !strings.HasPrefix(answer, "[") {
+			var items []interface{}
+			for _, item := range strings.Split(answer, ",") {
+				items = append(items, strings.TrimSpace(item))
+			}
+			return items
+		}
+	}
+	return ParseValue(answer)
+}
+
+func formatAnswer(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		var items []string
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,84 @@
+package pct
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RenderError describes a template file that could not be rendered. Line and
+// Column are zero when the error isn't tied to a position, and Partial names
+// the partial the error occurred in when it isn't in File itself.
+type RenderError struct {
+	File    string
+	Partial string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e RenderError) Error() string {
+	position := ""
+	if e.Line > 0 {
+		position = fmt.Sprintf(":%d", e.Line)
+		if e.Column > 0 {
+			position += fmt.Sprintf(":%d", e.Column)
+		}
+	}
+
+	if e.Partial != "" {
+		return fmt.Sprintf("%s: partial '%s'%s: %s", e.File, e.Partial, position, e.Message)
+	}
+	return fmt.Sprintf("%s%s: %s", e.File, position, e.Message)
+}
+
+// RenderErrors lists every file of a template that could not be rendered
+type RenderErrors []RenderError
+
+func (e RenderErrors) Error() string {
+	problems := make([]string, 0, len(e))
+	for _, r := range e {
+		problems = append(problems, r.Error())
+	}
+	return fmt.Sprintf("Unable to render the template:\n  * %s", strings.Join(problems, "\n  * "))
+}
+
+// templateErrorPattern matches the location text/template prefixes its parse
+// and execution errors with, eg "template: name:3:12: "
+var templateErrorPattern = regexp.MustCompile(`(?s)^template: (.*?):(\d+)(?::(\d+))?: (.*)$`)
+
+// newRenderError converts an error from rendering a file into a RenderError,
+// extracting the position text/template reports it at
+func newRenderError(file string, err error) RenderError {
+	var renderErr RenderError
+	if errors.As(err, &renderErr) {
+		return renderErr
+	}
+	renderErr = RenderError{File: file, Message: err.Error()}
+
+	match := templateErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return renderErr
+	}
+
+	if match[1] != filepath.Base(file) {
+		renderErr.Partial = match[1]
+	}
+	renderErr.Line, _ = strconv.Atoi(match[2])
+	renderErr.Column, _ = strconv.Atoi(match[3])
+	renderErr.Message = match[4]
+	return renderErr
+}
+
+// withLineOffset moves an error in the file itself down by lines that were
+// removed from the start of the file before it was parsed, such as front
+// matter
+func (e RenderError) withLineOffset(lines int) RenderError {
+	if e.Partial == "" && e.Line > 0 {
+		e.Line += lines
+	}
+	return e
+}
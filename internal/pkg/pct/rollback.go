@@ -0,0 +1,94 @@
+package pct
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+)
+
+// rollback records the changes a deployment makes to its target, so that a
+// deployment that fails part way through can be undone rather than leave a
+// half generated project behind
+type rollback struct {
+	created  []string
+	replaced []replacedFile
+	tracked  map[string]bool
+}
+
+// replacedFile holds the original content of a file a deployment overwrote
+type replacedFile struct {
+	path    string
+	content []byte
+	mode    os.FileMode
+}
+
+// track records the state of a path, and of any of its parent directories that
+// are missing, before a deployment first changes it
+func (r *rollback) track(afs *afero.Afero, path string) error {
+	if r.tracked == nil {
+		r.tracked = make(map[string]bool)
+	}
+	if r.tracked[path] {
+		return nil
+	}
+	r.tracked[path] = true
+
+	stat, err := afs.Stat(path)
+	if os.IsNotExist(err) {
+		if parent := filepath.Dir(path); parent != path {
+			if err := r.track(afs, parent); err != nil {
+				return err
+			}
+		}
+		r.created = append(r.created, path)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if stat.IsDir() {
+		return nil
+	}
+	content, err := afs.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r.replaced = append(r.replaced, replacedFile{path: path, content: content, mode: stat.Mode().Perm()})
+	return nil
+}
+
+// undo restores every file the deployment overwrote and removes every file and
+// directory it created, most recent first. Directories are removed along with
+// anything hooks wrote within them.
+func (r *rollback) undo(afs *afero.Afero) {
+	if len(r.created) == 0 && len(r.replaced) == 0 {
+		return
+	}
+	log.Warn().Msg("Rolling back the deployment")
+
+	for i := len(r.replaced) - 1; i >= 0; i-- {
+		f := r.replaced[i]
+		log.Debug().Msgf("Restoring: %s", f.path)
+		if err := afs.WriteFile(f.path, f.content, f.mode); err != nil {
+			log.Error().Msgf("Unable to restore '%s': %v", f.path, err)
+			continue
+		}
+		if err := afs.Chmod(f.path, f.mode); err != nil {
+			log.Error().Msgf("Unable to restore the mode of '%s': %v", f.path, err)
+		}
+	}
+
+	for i := len(r.created) - 1; i >= 0; i-- {
+		path := r.created[i]
+		log.Debug().Msgf("Removing: %s", path)
+		if err := afs.RemoveAll(path); err != nil {
+			log.Error().Msgf("Unable to remove '%s': %v", path, err)
+		}
+	}
+
+	r.created = nil
+	r.replaced = nil
+	r.tracked = nil
+}
@@ -0,0 +1,30 @@
+package pct
+
+import (
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ProjectRootMarkers are the files and directories that mark the root of a
+// project: a Puppet module's metadata.json, a Bolt project, a control repo's
+// Puppetfile, or the manifest of content PCT has deployed before
+var ProjectRootMarkers = []string{ModuleMetadataFileName, "bolt-project.yaml", "Puppetfile", ManifestDirName}
+
+// FindProjectRoot returns the nearest directory at or above dir that contains
+// one of the ProjectRootMarkers, or dir itself when none does
+func (p *Pct) FindProjectRoot(dir string) string {
+	for current := filepath.Clean(dir); ; current = filepath.Dir(current) {
+		for _, marker := range ProjectRootMarkers {
+			if exists, _ := p.AFS.Exists(filepath.Join(current, marker)); exists {
+				if current != filepath.Clean(dir) {
+					log.Info().Msgf("Deploying to the project root '%s', found by its %s", current, marker)
+				}
+				return current
+			}
+		}
+		if filepath.Dir(current) == current {
+			return dir
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package pct
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/puppetlabs/pct/pkg/template_funcs"
+)
+
+// TemplateFileRule conditionally includes or excludes the content matching a
+// glob. When is a Go template expression evaluated against the merged values,
+// eg "{{ .acceptance_tests }}"; the braces may be omitted. A glob matching a
+// directory applies to everything within it.
+type TemplateFileRule struct {
+	Glob string `mapstructure:"glob"`
+	When string `mapstructure:"when"`
+}
+
+// evaluateFileRules returns the globs whose content should not be deployed:
+// those of include rules that evaluate false and exclude rules that evaluate
+// true
+func evaluateFileRules(tmpl PuppetContentTemplateInfo, config map[string]interface{}) ([]string, error) {
+	var excluded []string
+
+	for _, rule := range tmpl.Include {
+		result, err := evaluateCondition(rule.When, config)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to evaluate include rule for '%s': %v", rule.Glob, err)
+		}
+		if !result {
+			excluded = append(excluded, rule.Glob)
+		}
+	}
+
+	for _, rule := range tmpl.Exclude {
+		result, err := evaluateCondition(rule.When, config)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to evaluate exclude rule for '%s': %v", rule.Glob, err)
+		}
+		if result {
+			excluded = append(excluded, rule.Glob)
+		}
+	}
+
+	return excluded, nil
+}
+
+// evaluateCondition renders a template expression and reports whether the
+// result is true. Empty results, false, 0 and missing values are false, as is
+// an empty expression.
+func evaluateCondition(expression string, config map[string]interface{}) (bool, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return false, nil
+	}
+	if !strings.Contains(expression, "{{") {
+		expression = "{{ " + expression + " }}"
+	}
+
+	result, err := renderString(expression, config)
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(result)) {
+	case "", "false", "0", "<no value>":
+		return false, nil
+	}
+	return true, nil
+}
+
+// matchesContentRule reports whether a path relative to the content directory,
+// or any directory containing it, matches one of the given globs
+func matchesContentRule(globs []string, rel string) bool {
+	for _, glob := range globs {
+		for dir := filepath.ToSlash(rel); dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+			if matchesContentGlob(glob, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderString renders a snippet of template configuration, such as a rule's
+// condition, with the merged values and any template options, eg
+// missingkey=error
+func renderString(text string, config map[string]interface{}, options ...string) (string, error) {
+	tmpl, err := template.New("config").Funcs(template_funcs.FuncMap()).Option(options...).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	allowOptionalValues(tmpl)
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, config); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
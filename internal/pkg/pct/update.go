@@ -0,0 +1,129 @@
+package pct
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/puppetlabs/pct/pkg/merge"
+	"github.com/rs/zerolog/log"
+)
+
+// UpdateInfo represents the information needed to move a project generated from
+// one version of a template on to another version of the same template
+type UpdateInfo struct {
+	DeployInfo
+	PreviousTemplateDirPath string
+}
+
+// Update re-renders both the template version a project was generated from and
+// the version being updated to using the same values, then three-way merges the
+// changes between the two into the project's working files. Regions changed
+// differently by both the user and the template are left with conflict markers.
+// If any file can't be written, every change already made is rolled back.
+func (p *Pct) Update(info UpdateInfo) ([]DeployedFile, error) {
+	previousInfo := info.DeployInfo
+	previousInfo.TemplateDirPath = info.PreviousTemplateDirPath
+
+	log.Debug().Msgf("Rendering previous template: %s", previousInfo.TemplateDirPath)
+	previousPlan, err := p.planDeployment(previousInfo)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[string]plannedFile)
+	for _, f := range previousPlan.files {
+		if !f.templateFile.IsDirectory && f.action != DeployActionExclude {
+			previous[f.templateFile.TargetFilePath] = f
+		}
+	}
+
+	log.Debug().Msgf("Rendering updated template: %s", info.TemplateDirPath)
+	label := "template " + filepath.Base(info.TemplateDirPath)
+	plan, err := p.planDeployment(info.DeployInfo)
+	if err != nil {
+		return nil, err
+	}
+	journal := &rollback{}
+	var updated []DeployedFile
+	for i, f := range plan.files {
+		if !f.templateFile.IsDirectory && f.action != DeployActionExclude {
+			f = p.planUpdate(f, previous, label)
+			plan.files[i] = f
+		}
+
+		if !info.DryRun {
+			if err := p.applyPlannedFile(f, journal); err != nil {
+				journal.undo(p.AFS)
+				return nil, fmt.Errorf("Unable to update '%s': %v", f.templateFile.TargetFilePath, err)
+			}
+		}
+		updated = append(updated, DeployedFile{Path: f.templateFile.TargetFilePath, Action: f.action, DryRun: info.DryRun})
+	}
+
+	if !info.DryRun {
+		p.recordDeployment(plan)
+	}
+
+	return updated, nil
+}
+
+// planUpdate decides how to bring a single working file up to date with its
+// newly rendered content, returning the file with the action to take and the
+// content to write. Files are compared by checksum, and only rendered templates
+// are read in full to be merged.
+func (p *Pct) planUpdate(f plannedFile, previous map[string]plannedFile, label string) plannedFile {
+	target := f.templateFile.TargetFilePath
+	base, inPrevious := previous[target]
+
+	ours, err := p.fileChecksum(target)
+	if err != nil {
+		if inPrevious && base.checksum == f.checksum {
+			// The user removed a file the template hasn't changed; leave it removed
+			f.action = DeployActionSkip
+			return f
+		}
+		f.action = DeployActionCreate
+		return f
+	}
+
+	switch {
+	case ours == f.checksum, inPrevious && base.checksum == f.checksum:
+		f.action = DeployActionUnchanged
+		f.checksum = ours
+		return f
+	case inPrevious && ours == base.checksum:
+		f.action = DeployActionOverwrite
+		return f
+	}
+
+	if !f.templateFile.IsTemplate {
+		// Files copied verbatim may be binary and can't be merged line by line
+		log.Warn().Msgf("'%s' was changed by both the template and the working copy; keeping the working copy", target)
+		f.action = DeployActionConflict
+		f.checksum = ours
+		return f
+	}
+
+	working, err := p.AFS.ReadFile(target)
+	if err != nil {
+		f.action = DeployActionOverwrite
+		return f
+	}
+	baseText := base.text
+	if inPrevious && !base.templateFile.IsTemplate {
+		// The file was copied verbatim by the previous version
+		content, err := p.AFS.ReadFile(base.templateFile.TemplatePath)
+		if err != nil {
+			log.Debug().Msgf("Unable to read the previous version of '%s': %v", target, err)
+		}
+		baseText = string(content)
+	}
+	merged, conflicts := merge.ThreeWay(baseText, string(working), f.text, merge.Labels{Ours: "working copy", Theirs: label})
+	f.action = DeployActionMerge
+	if conflicts > 0 {
+		log.Warn().Msgf("%d conflict(s) merging '%s'", conflicts, target)
+		f.action = DeployActionConflict
+	}
+	f.text = merged
+	f.checksum = textChecksum(merged)
+	return f
+}
@@ -0,0 +1,136 @@
+package pct
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ParseSetValues turns a list of key=value overrides into nested values. Keys
+// may be dotted to set nested values and each value is interpreted by
+// ParseValue.
+func ParseSetValues(sets []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, set := range sets {
+		key, value, found := strings.Cut(set, "=")
+		key = strings.TrimSpace(key)
+		if !found || !validValueKey(key) {
+			return nil, fmt.Errorf("Invalid value '%s', expected key=value", set)
+		}
+		setValue(values, key, ParseValue(value))
+	}
+	return values, nil
+}
+
+// validValueKey reports whether a dotted key names a value, ie has no empty
+// segments
+func validValueKey(key string) bool {
+	for _, part := range strings.Split(key, ".") {
+		if part == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseValue interprets a string as YAML, so "true" becomes a boolean, "8080" an
+// integer and "[a, b]" a list. Anything that is not valid YAML is kept as a
+// string, as is a number that would be written differently, such as the
+// version 1.10 or the mode 0755, so text that only looks like a number isn't
+// changed.
+func ParseValue(s string) interface{} {
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(s), &value); err != nil || value == nil {
+		return s
+	}
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		return s
+	case int, int64, uint64, float64:
+		if formatNumber(v) != strings.TrimSpace(s) {
+			return s
+		}
+	}
+	return value
+}
+
+// formatNumber writes a number as plainly as possible, eg 0.5 or 8080
+func formatNumber(n interface{}) string {
+	if f, ok := n.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(n)
+}
+
+// typeNumericValues converts text values, eg from --set, to the numbers their
+// parameters declare, as ParseValue keeps numbers such as 1.10 as text
+func typeNumericValues(tmpl PuppetContentTemplateInfo, values map[string]interface{}) {
+	for _, param := range tmpl.Parameters {
+		if param.Type != ParameterTypeInteger && param.Type != ParameterTypeNumber {
+			continue
+		}
+		if value, found := lookupValue(values, param.Name); found {
+			if text, isText := value.(string); isText {
+				setValue(values, param.Name, parseAnswer(text, param.Type))
+			}
+		}
+	}
+}
+
+// flattenValues collects every leaf of a set of nested values under its dotted
+// key
+func flattenValues(prefix string, values map[string]interface{}, flattened map[string]interface{}) {
+	for k, v := range values {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch nested := v.(type) {
+		case map[string]interface{}:
+			flattenValues(key, nested, flattened)
+		case map[interface{}]interface{}:
+			m := make(map[string]interface{}, len(nested))
+			for nk, nv := range nested {
+				m[fmt.Sprint(nk)] = nv
+			}
+			flattenValues(key, m, flattened)
+		default:
+			flattened[key] = v
+		}
+	}
+}
+
+// lookupValue finds a dotted key in a set of nested values. Keys are matched
+// case insensitively, as every configuration layer lower cases them.
+func lookupValue(values map[string]interface{}, key string) (interface{}, bool) {
+	var current interface{} = values
+	for _, part := range strings.Split(strings.ToLower(key), ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setValue sets a dotted key in a set of nested values, creating intermediate
+// maps as needed
+func setValue(values map[string]interface{}, key string, value interface{}) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	current := values
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
@@ -3,6 +3,7 @@ package pct_config_processor
 import (
 	"bytes"
 	"fmt"
+	"path/filepath"
 
 	"github.com/puppetlabs/pct/internal/pkg/pct"
 	"github.com/puppetlabs/pct/pkg/config_processor"
@@ -56,6 +57,22 @@ func (p *PctConfigProcessor) CheckConfig(configFile string) error {
 		return fmt.Errorf(msg)
 	}
 
+	if err := pct.ValidateParameterSchema(info.Parameters); err != nil {
+		return fmt.Errorf("%s in %s", err, configFile)
+	}
+
+	if err := pct.ValidateDelimiters(info); err != nil {
+		return fmt.Errorf("%s in %s", err, configFile)
+	}
+
+	if err := pct.ValidateComputed(info); err != nil {
+		return fmt.Errorf("%s in %s", err, configFile)
+	}
+
+	if err := pct.CheckPartials(p.AFS, filepath.Dir(configFile), info); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -110,6 +110,74 @@ foo: bar
 `,
 			errorMsg: `The following attributes are missing in .+:\s+\* id\s+\* author\s+\* version`,
 		},
+		{
+			name:           "When parameters valid",
+			mockConfigFile: true,
+			configFilePath: "my/valid/parameters/pct-config.yml",
+
+			configFileYaml: `---
+template:
+  id: test-template
+  author: test-user
+  version: 0.1.0
+parameters:
+  - name: module_name
+    type: string
+    pattern: "^[a-z][a-z0-9_]*$"
+    required: true
+  - name: puppet_module.platforms
+    type: list
+    default: [RedHat]
+    min: 1
+  - name: port
+    type: integer
+    default: 8080
+    min: 1
+    max: 65535
+`,
+			errorMsg: "",
+		},
+		{
+			name:           "When parameters invalid",
+			mockConfigFile: true,
+			configFilePath: "my/invalid/parameters/pct-config.yml",
+
+			configFileYaml: `---
+template:
+  id: test-template
+  author: test-user
+  version: 0.1.0
+parameters:
+  - type: string
+  - name: size
+    type: huge
+  - name: module_name
+    pattern: "([a-z"
+  - name: port
+    type: integer
+    default: http
+  - name: ensure
+    type: string
+    enum: [present, 1]
+`,
+			errorMsg: `Invalid parameters:\s+\* parameter 1: a name is required\s+\* size: unknown type 'huge'.*\s+\* module_name: invalid pattern.*\s+\* port: default must be of type integer\s+\* ensure: enum value 1 must be of type string\s+in my/invalid/parameters/pct-config.yml`,
+		},
+		{
+			name:           "When computed values depend on each other",
+			mockConfigFile: true,
+			configFilePath: "my/invalid/computed/pct-config.yml",
+
+			configFileYaml: `---
+template:
+  id: test-template
+  author: test-user
+  version: 0.1.0
+computed:
+  class_name: "{{ .module_name | snake }}"
+  module_name: "{{ .class_name }}"
+`,
+			errorMsg: `Computed values depend on each other in a cycle: class_name -> module_name -> class_name in my/invalid/computed/pct-config.yml`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -127,8 +195,10 @@ foo: bar
 
 			err := configProcessor.CheckConfig(tt.configFilePath)
 
-			if tt.errorMsg != "" && err != nil {
-				assert.Regexp(t, regexp.MustCompile(tt.errorMsg), err.Error())
+			if tt.errorMsg != "" {
+				if assert.Error(t, err) {
+					assert.Regexp(t, regexp.MustCompile(tt.errorMsg), err.Error())
+				}
 			} else {
 				assert.NoError(t, err)
 			}
@@ -13,6 +13,7 @@ import (
 	cmd_install "github.com/puppetlabs/pct/cmd/install"
 	"github.com/puppetlabs/pct/cmd/new"
 	"github.com/puppetlabs/pct/cmd/root"
+	"github.com/puppetlabs/pct/cmd/update"
 	appver "github.com/puppetlabs/pct/cmd/version"
 	"github.com/puppetlabs/pct/pkg/build"
 	"github.com/puppetlabs/pct/pkg/gzip"
@@ -93,6 +94,9 @@ func main() {
 	// new
 	rootCmd.AddCommand(new.CreateCommand())
 
+	// update
+	rootCmd.AddCommand(update.CreateCommand())
+
 	// explain
 	rootCmd.AddCommand(explain.CreateCommand())
 
@@ -23,18 +23,17 @@ func TestBuild(t *testing.T) {
 	var mockConfigFilePath = filepath.Clean(filepath.Join(mockSourceDir, "my-config.yml"))
 
 	tests := []struct {
-		name                    string
-		args                    args
-		mockIsModuleRootErrResp error
-		mockDirs                []string
-		mockFiles               map[string]string
-		expectedFilePath        string
-		tarFile                 string
-		gzipFile                string
-		expectedErr             string
-		mockTarErr              bool
-		mockGzipErr             bool
-		testTempDir             string
+		name             string
+		args             args
+		mockDirs         []string
+		mockFiles        map[string]string
+		expectedFilePath string
+		tarFile          string
+		gzipFile         string
+		expectedErr      string
+		mockTarErr       bool
+		mockGzipErr      bool
+		testTempDir      string
 	}{
 		{
 			name: "Should return err if project folder path does not exist",
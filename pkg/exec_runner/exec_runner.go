@@ -1,9 +1,12 @@
 package exec_runner
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"runtime"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -11,10 +14,23 @@ import (
 type ExecI interface {
 	Command(name string, arg ...string) error
 	Output() ([]byte, error)
+	// SetDir sets the working directory of the current command
+	SetDir(dir string)
+	// SetEnv adds variables, in key=value form, to the environment of the
+	// current command
+	SetEnv(env ...string)
+	// SetOutput streams the output of the current command to the given writers
+	// when it is Run
+	SetOutput(stdout io.Writer, stderr io.Writer)
+	// SetTimeout kills the current command if it runs for longer than timeout.
+	// A timeout of zero never kills the command.
+	SetTimeout(timeout time.Duration)
+	Run() error
 }
 
 type Exec struct {
-	cmd *exec.Cmd
+	cmd     *exec.Cmd
+	timeout time.Duration
 }
 
 func (e *Exec) Command(name string, arg ...string) error {
@@ -40,6 +56,7 @@ func (e *Exec) Command(name string, arg ...string) error {
 		Env:  os.Environ(),
 	}
 	e.cmd = cmd
+	e.timeout = 0
 	return nil
 }
 
@@ -47,6 +64,44 @@ func (e *Exec) Output() ([]byte, error) {
 	return e.cmd.Output()
 }
 
+func (e *Exec) SetDir(dir string) {
+	e.cmd.Dir = dir
+}
+
+func (e *Exec) SetEnv(env ...string) {
+	e.cmd.Env = append(e.cmd.Env, env...)
+}
+
+func (e *Exec) SetOutput(stdout io.Writer, stderr io.Writer) {
+	e.cmd.Stdout = stdout
+	e.cmd.Stderr = stderr
+}
+
+func (e *Exec) SetTimeout(timeout time.Duration) {
+	e.timeout = timeout
+}
+
+// Run starts the current command and waits for it to finish, killing it if it
+// exceeds its timeout
+func (e *Exec) Run() error {
+	if err := e.cmd.Start(); err != nil {
+		return err
+	}
+	if e.timeout <= 0 {
+		return e.cmd.Wait()
+	}
+
+	process := e.cmd.Process
+	timer := time.AfterFunc(e.timeout, func() {
+		process.Kill() //nolint:errcheck
+	})
+	err := e.cmd.Wait()
+	if !timer.Stop() {
+		return fmt.Errorf("timed out after %s", e.timeout)
+	}
+	return err
+}
+
 func buildCommandArgs(commandName string, args []string) []string {
 	var a []string
 	if runtime.GOOS == "windows" {
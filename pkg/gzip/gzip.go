@@ -3,6 +3,7 @@ package gzip
 import (
 	"compress/gzip"
 	"fmt"
+	"io"
 	"path/filepath"
 
 	"github.com/puppetlabs/pct/pkg/utils"
@@ -42,19 +43,23 @@ func (g *Gzip) Gzip(source, target string) (gzipFilePath string, err error) {
 		}
 	}()
 
-	archiver := gzip.NewWriter(writer)
-	archiver.Name = filename
-
-	defer func() {
-		if err := archiver.Close(); err != nil {
-			log.Error().Msgf("Error closing writer: %s\n", err)
-		}
-	}()
-
-	err = utils.ChunkedCopy(archiver, reader)
+	err = g.Write(writer, reader, filename)
 	if err != nil {
 		return "", err
 	}
 
 	return target, err
 }
+
+// Write compresses everything read from r to w, recording name as the name of
+// the compressed file
+func (g *Gzip) Write(w io.Writer, r io.Reader, name string) error {
+	archiver := gzip.NewWriter(w)
+	archiver.Name = name
+
+	if err := utils.ChunkedCopy(archiver, r); err != nil {
+		archiver.Close() //nolint:errcheck
+		return err
+	}
+	return archiver.Close()
+}
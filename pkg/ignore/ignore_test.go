@@ -0,0 +1,49 @@
+package ignore_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/puppetlabs/pct/pkg/ignore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{name: "name at any depth", patterns: ".DS_Store", path: "content/manifests/.DS_Store", want: true},
+		{name: "wildcard", patterns: "*.swp", path: "content/init.pp.swp", want: true},
+		{name: "wildcard does not cross directories", patterns: "content/*.pp", path: "content/manifests/init.pp", want: false},
+		{name: "anchored pattern", patterns: "/README.md", path: "README.md", want: true},
+		{name: "anchored pattern at depth", patterns: "/README.md", path: "content/README.md", want: false},
+		{name: "pattern with a slash is anchored", patterns: "spec/fixtures", path: "content/spec/fixtures", want: false},
+		{name: "directory only pattern", patterns: "fixtures/", path: "spec/fixtures", isDir: true, want: true},
+		{name: "directory only pattern skips files", patterns: "fixtures/", path: "spec/fixtures", want: false},
+		{name: "contents of ignored directory", patterns: "fixtures/", path: "spec/fixtures/modules/init.pp", want: true},
+		{name: "leading double star", patterns: "**/tmp", path: "a/b/tmp", isDir: true, want: true},
+		{name: "trailing double star", patterns: "docs/**", path: "docs/a/b.md", want: true},
+		{name: "middle double star", patterns: "a/**/b", path: "a/b", want: true},
+		{name: "middle double star with directories", patterns: "a/**/b", path: "a/x/y/b", want: true},
+		{name: "negation", patterns: "*.md\n!CHANGELOG.md", path: "CHANGELOG.md", want: false},
+		{name: "negation of later match", patterns: "!CHANGELOG.md\n*.md", path: "CHANGELOG.md", want: true},
+		{name: "negation within ignored directory", patterns: "docs/\n!docs/index.md", path: "docs/index.md", want: true},
+		{name: "comments and blank lines", patterns: "# comment\n\n#README.md", path: "#README.md", want: false},
+		{name: "escaped hash", patterns: `\#notes`, path: "#notes", want: true},
+		{name: "character class", patterns: "*.py[cod]", path: "x.pyc", want: true},
+		{name: "negated character class", patterns: "file[!0-9]", path: "file1", want: false},
+		{name: "question mark", patterns: "?.txt", path: "a.txt", want: true},
+		{name: "no patterns", patterns: "", path: "anything", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ignore.Read(strings.NewReader(tt.patterns))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, m.Match(tt.path, tt.isDir))
+		})
+	}
+}
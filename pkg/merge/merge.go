@@ -0,0 +1,162 @@
+package merge
+
+import (
+	"strings"
+)
+
+// Labels name each side of a conflict in the markers written into merged output
+type Labels struct {
+	Ours   string
+	Theirs string
+}
+
+// ThreeWay performs a line based three-way merge of two descendants of a
+// common base. Changes made on only one side are taken as-is; regions changed
+// differently on both sides are written with conflict markers. It returns the
+// merged text and the number of conflicting regions.
+func ThreeWay(base, ours, theirs string, labels Labels) (merged string, conflicts int) {
+	baseLines := splitLines(base)
+	ourLines := splitLines(ours)
+	theirLines := splitLines(theirs)
+
+	ourMatches := matchLines(baseLines, ourLines)
+	theirMatches := matchLines(baseLines, theirLines)
+
+	var out strings.Builder
+	b, o, t := 0, 0, 0
+	for {
+		// Count the lines that are unchanged on both sides from this point
+		stable := 0
+		for b+stable < len(baseLines) &&
+			ourMatches[b+stable] == o+stable &&
+			theirMatches[b+stable] == t+stable {
+			stable++
+		}
+
+		if stable > 0 {
+			writeLines(&out, baseLines[b:b+stable])
+			b, o, t = b+stable, o+stable, t+stable
+			continue
+		}
+
+		// Find the next base line that both sides still contain
+		next := b
+		for next < len(baseLines) && (ourMatches[next] < 0 || theirMatches[next] < 0) {
+			next++
+		}
+
+		oEnd, tEnd := len(ourLines), len(theirLines)
+		if next < len(baseLines) {
+			oEnd, tEnd = ourMatches[next], theirMatches[next]
+		}
+
+		if next == b && oEnd == o && tEnd == t {
+			// Nothing left to merge
+			break
+		}
+
+		if resolveChunk(&out, baseLines[b:next], ourLines[o:oEnd], theirLines[t:tEnd], labels) {
+			conflicts++
+		}
+		b, o, t = next, oEnd, tEnd
+	}
+
+	return out.String(), conflicts
+}
+
+// resolveChunk writes the merged form of a region that changed on at least
+// one side, returning true if both sides changed it differently
+func resolveChunk(out *strings.Builder, base, ours, theirs []string, labels Labels) bool {
+	switch {
+	case equalLines(ours, base):
+		writeLines(out, theirs)
+	case equalLines(theirs, base), equalLines(ours, theirs):
+		writeLines(out, ours)
+	default:
+		out.WriteString("<<<<<<< " + labels.Ours + "\n")
+		writeConflictLines(out, ours)
+		out.WriteString("=======\n")
+		writeConflictLines(out, theirs)
+		out.WriteString(">>>>>>> " + labels.Theirs + "\n")
+		return true
+	}
+	return false
+}
+
+// matchLines returns, for each line of a, the index of the line of b it is
+// paired with in a longest common subsequence of the two, or -1
+func matchLines(a, b []string) []int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	matches := make([]int, len(a))
+	i, j := 0, 0
+	for i < len(a) {
+		switch {
+		case j < len(b) && a[i] == b[j]:
+			matches[i] = j
+			i++
+			j++
+		case j < len(b) && lcs[i][j+1] > lcs[i+1][j]:
+			j++
+		default:
+			matches[i] = -1
+			i++
+		}
+	}
+	return matches
+}
+
+// splitLines splits text into lines, keeping each line's terminator so that
+// merged output reproduces the original line endings
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, l := range lines {
+		out.WriteString(l)
+	}
+}
+
+// writeConflictLines writes one side of a conflict, making sure the following
+// marker starts on its own line
+func writeConflictLines(out *strings.Builder, lines []string) {
+	writeLines(out, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		out.WriteString("\n")
+	}
+}
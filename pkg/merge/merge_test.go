@@ -0,0 +1,114 @@
+package merge_test
+
+import (
+	"testing"
+
+	"github.com/puppetlabs/pct/pkg/merge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThreeWay(t *testing.T) {
+	type args struct {
+		base   string
+		ours   string
+		theirs string
+	}
+	tests := []struct {
+		name          string
+		args          args
+		want          string
+		wantConflicts int
+	}{
+		{
+			name: "when nothing has changed",
+			args: args{
+				base:   "one\ntwo\nthree\n",
+				ours:   "one\ntwo\nthree\n",
+				theirs: "one\ntwo\nthree\n",
+			},
+			want: "one\ntwo\nthree\n",
+		},
+		{
+			name: "when only ours has changed",
+			args: args{
+				base:   "one\ntwo\nthree\n",
+				ours:   "one\n2\nthree\n",
+				theirs: "one\ntwo\nthree\n",
+			},
+			want: "one\n2\nthree\n",
+		},
+		{
+			name: "when only theirs has changed",
+			args: args{
+				base:   "one\ntwo\nthree\n",
+				ours:   "one\ntwo\nthree\n",
+				theirs: "one\ntwo\nthree\nfour\n",
+			},
+			want: "one\ntwo\nthree\nfour\n",
+		},
+		{
+			name: "when both sides changed different lines",
+			args: args{
+				base:   "one\ntwo\nthree\nfour\nfive\n",
+				ours:   "ONE\ntwo\nthree\nfour\nfive\n",
+				theirs: "one\ntwo\nthree\nfour\nFIVE\n",
+			},
+			want: "ONE\ntwo\nthree\nfour\nFIVE\n",
+		},
+		{
+			name: "when both sides made the same change",
+			args: args{
+				base:   "one\ntwo\n",
+				ours:   "one\n2\n",
+				theirs: "one\n2\n",
+			},
+			want: "one\n2\n",
+		},
+		{
+			name: "when both sides changed the same line differently",
+			args: args{
+				base:   "one\ntwo\nthree\n",
+				ours:   "one\nmine\nthree\n",
+				theirs: "one\nyours\nthree\n",
+			},
+			want:          "one\n<<<<<<< working\nmine\n=======\nyours\n>>>>>>> template\nthree\n",
+			wantConflicts: 1,
+		},
+		{
+			name: "when a conflicting line has no trailing newline",
+			args: args{
+				base:   "one\ntwo",
+				ours:   "one\nmine",
+				theirs: "one\nyours",
+			},
+			want:          "one\n<<<<<<< working\nmine\n=======\nyours\n>>>>>>> template\n",
+			wantConflicts: 1,
+		},
+		{
+			name: "when there is no base",
+			args: args{
+				base:   "",
+				ours:   "mine\n",
+				theirs: "yours\n",
+			},
+			want:          "<<<<<<< working\nmine\n=======\nyours\n>>>>>>> template\n",
+			wantConflicts: 1,
+		},
+		{
+			name: "when ours deleted a line theirs left alone",
+			args: args{
+				base:   "one\ntwo\nthree\n",
+				ours:   "one\nthree\n",
+				theirs: "zero\none\ntwo\nthree\n",
+			},
+			want: "zero\none\nthree\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := merge.ThreeWay(tt.args.base, tt.args.ours, tt.args.theirs, merge.Labels{Ours: "working", Theirs: "template"})
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantConflicts, conflicts)
+		})
+	}
+}
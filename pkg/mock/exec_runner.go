@@ -2,19 +2,38 @@ package mock
 
 import (
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
+	"time"
 )
 
 type Exec struct {
 	ExpectedName string
 	ExpectedArg  []string
 
+	// AnyCommand accepts every command rather than only the expected one
+	AnyCommand bool
+	// FailCommand is a command Run fails for, matched against its last argument
+	FailCommand string
+
 	ResponseMsg   string
 	ResponseError bool
+
+	// Commands records each command run, with its arguments joined by spaces,
+	// alongside the directory, environment and timeout it was given
+	Commands []string
+	Dir      string
+	Env      []string
+	Timeout  time.Duration
+
+	current []string
+	stdout  io.Writer
 }
 
 func (e *Exec) Command(name string, arg ...string) error {
-	if name == e.ExpectedName && reflect.DeepEqual(arg, e.ExpectedArg) {
+	if e.AnyCommand || (name == e.ExpectedName && reflect.DeepEqual(arg, e.ExpectedArg)) {
+		e.current = append([]string{name}, arg...)
 		return nil
 	}
 	return fmt.Errorf("Unexpected Command %v %v", name, arg)
@@ -26,3 +45,30 @@ func (e *Exec) Output() ([]byte, error) {
 	}
 	return []byte(e.ResponseMsg), nil
 }
+
+func (e *Exec) SetDir(dir string) {
+	e.Dir = dir
+}
+
+func (e *Exec) SetEnv(env ...string) {
+	e.Env = append(e.Env, env...)
+}
+
+func (e *Exec) SetOutput(stdout io.Writer, stderr io.Writer) {
+	e.stdout = stdout
+}
+
+func (e *Exec) SetTimeout(timeout time.Duration) {
+	e.Timeout = timeout
+}
+
+func (e *Exec) Run() error {
+	e.Commands = append(e.Commands, strings.Join(e.current, " "))
+	if e.FailCommand != "" && len(e.current) > 0 && e.current[len(e.current)-1] == e.FailCommand {
+		return fmt.Errorf("exit status 1")
+	}
+	if e.stdout != nil && e.ResponseMsg != "" {
+		fmt.Fprintln(e.stdout, e.ResponseMsg)
+	}
+	return nil
+}
@@ -5,7 +5,8 @@ import (
 )
 
 type OsUtil struct {
-	WD string
+	WD  string
+	Env []string
 }
 
 func (*OsUtil) Hostname() (name string, err error) {
@@ -19,3 +20,7 @@ func (*OsUtil) WriteString(w io.Writer, s string) (n int, err error) {
 func (o *OsUtil) Getwd() (dir string, err error) {
 	return o.WD, nil
 }
+
+func (o *OsUtil) Environ() []string {
+	return o.Env
+}
@@ -1,21 +1,9 @@
 package mock
 
-import (
-	"path/filepath"
-)
-
 type UtilsHelper struct {
-	TestDir             string
-	IsModuleRootErrResp error
-	Home                string
-	ReaderError         bool
-}
-
-func (u *UtilsHelper) IsModuleRoot() (string, error) {
-	if u.IsModuleRootErrResp != nil {
-		return "", u.IsModuleRootErrResp
-	}
-	return filepath.Clean(u.TestDir), nil
+	TestDir     string
+	Home        string
+	ReaderError bool
 }
 
 func (u *UtilsHelper) Dir() (string, error) {
@@ -9,6 +9,7 @@ import (
 
 	"strings"
 
+	"github.com/puppetlabs/pct/pkg/ignore"
 	"github.com/puppetlabs/pct/pkg/utils"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/afero"
@@ -51,8 +52,13 @@ func (t *Tar) Tar(source, target string) (tarFilePath string, err error) {
 	}
 
 	var baseDir string
+	var ignored *ignore.Matcher
 	if info.IsDir() {
 		baseDir = filepath.Base(source)
+		ignored, err = t.readIgnoreFile(filepath.Join(source, ignore.FileName))
+		if err != nil {
+			return "", err
+		}
 	}
 
 	err = t.AFS.Walk(source,
@@ -61,43 +67,103 @@ func (t *Tar) Tar(source, target string) (tarFilePath string, err error) {
 				return err
 			}
 
-			header, err := tar.FileInfoHeader(info, info.Name())
-			if err != nil {
-				return err
+			if rel, err := filepath.Rel(source, path); err == nil && ignored.Match(filepath.ToSlash(rel), info.IsDir()) {
+				log.Debug().Msgf("Ignoring: %s", path)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
 			}
 
+			name := info.Name()
 			if baseDir != "" {
-				header.Name = filepath.Join(baseDir, strings.TrimPrefix(path, source))
+				name = filepath.ToSlash(filepath.Join(baseDir, strings.TrimPrefix(path, source)))
 			}
+			return t.writeEntry(tarball, path, info, name)
+		})
 
-			if err := tarball.WriteHeader(header); err != nil {
-				return err
-			}
+	if err != nil {
+		return "", err
+	}
 
-			if info.IsDir() {
-				return nil
-			}
+	return target, err
+}
 
-			file, err := t.AFS.Open(filepath.Clean(path))
-			if err != nil {
-				return err
-			}
+// Write streams the contents of a directory to w as a tar archive, with each
+// entry named relative to the directory
+func (t *Tar) Write(w io.Writer, source string) error {
+	tarball := tar.NewWriter(w)
 
-			defer func() {
-				if err := file.Close(); err != nil {
-					log.Error().Msgf("Error closing file: %s\n", err)
-				}
-			}()
+	err := t.AFS.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 
-			_, err = io.Copy(tarball, file)
+		rel, err := filepath.Rel(source, path)
+		if err != nil || rel == "." {
 			return err
-		})
+		}
+		name := filepath.ToSlash(rel)
+		if info.IsDir() {
+			name += "/"
+		}
+		return t.writeEntry(tarball, path, info, name)
+	})
+	if err != nil {
+		return err
+	}
 
+	return tarball.Close()
+}
+
+// writeEntry writes the header and any content of a single file or directory
+func (t *Tar) writeEntry(tarball *tar.Writer, path string, info os.FileInfo, name string) error {
+	header, err := tar.FileInfoHeader(info, info.Name())
 	if err != nil {
-		return "", err
+		return err
 	}
+	header.Name = name
 
-	return target, err
+	if err := tarball.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return nil
+	}
+
+	file, err := t.AFS.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error().Msgf("Error closing file: %s\n", err)
+		}
+	}()
+
+	_, err = io.Copy(tarball, file)
+	return err
+}
+
+// readIgnoreFile reads the patterns of files to leave out of an archive, if
+// the directory being archived has an ignore file
+func (t *Tar) readIgnoreFile(path string) (*ignore.Matcher, error) {
+	file, err := t.AFS.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error().Msgf("Error closing file: %s\n", err)
+		}
+	}()
+
+	return ignore.Read(file)
 }
 
 func (t *Tar) Untar(tarball, target string) (outputDirPath string, err error) {
@@ -135,20 +201,7 @@ func (t *Tar) Untar(tarball, target string) (outputDirPath string, err error) {
 			continue
 		}
 
-		file, err := t.AFS.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
-
-		defer func() {
-			if err := file.Close(); err != nil {
-				log.Error().Msgf("Error closing file: %s", err)
-			}
-		}()
-
-		if err != nil {
-			return "", err
-		}
-
-		err = utils.ChunkedCopy(file, tarReader)
-		if err != nil {
+		if err = t.untarFile(tarReader, filepath.Clean(path), info.Mode()); err != nil {
 			return "", err
 		}
 	}
@@ -158,3 +211,30 @@ func (t *Tar) Untar(tarball, target string) (outputDirPath string, err error) {
 
 	return targetDirPath, nil
 }
+
+// untarFile writes the current entry of a tar reader to path. The mode is set
+// explicitly once the file is written, as OpenFile is subject to the umask and
+// does not change the mode of an existing file.
+func (t *Tar) untarFile(tarReader io.Reader, path string, mode os.FileMode) error {
+	// Archives are not required to contain entries for parent directories
+	if err := t.AFS.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+
+	file, err := t.AFS.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error().Msgf("Error closing file: %s", err)
+		}
+	}()
+
+	if err = utils.ChunkedCopy(file, tarReader); err != nil {
+		return err
+	}
+
+	return t.AFS.Chmod(path, mode.Perm())
+}
@@ -1,11 +1,13 @@
 package tar_test
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/puppetlabs/pct/pkg/tar"
 	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestTar(t *testing.T) {
@@ -400,3 +402,76 @@ func TestUntar(t *testing.T) {
 		})
 	}
 }
+
+func TestTarRoundTripsModes(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afs := &afero.Afero{Fs: fs}
+
+	files := map[string]os.FileMode{
+		"content/scripts/bootstrap.sh.tmpl": 0755,
+		"content/tasks/init.sh":             0750,
+		"content/README.md":                 0644,
+		"content/secret.txt":                0600,
+	}
+
+	source := "testdata/examples/modes"
+	for file, mode := range files {
+		path := filepath.Join(source, file)
+		afs.MkdirAll(filepath.Dir(path), 0750)       //nolint:errcheck
+		afs.WriteFile(path, []byte("content"), mode) //nolint:errcheck
+		afs.Chmod(path, mode)                        //nolint:errcheck
+	}
+
+	tarDir, _ := afs.TempDir("", "")
+	tr := &tar.Tar{AFS: afs}
+	tarFile, err := tr.Tar(source, tarDir)
+	assert.NoError(t, err)
+
+	untarDir, _ := afs.TempDir("", "")
+	outputDir, err := tr.Untar(tarFile, untarDir)
+	assert.NoError(t, err)
+
+	for file, mode := range files {
+		info, err := afs.Stat(filepath.Join(outputDir, file))
+		if assert.NoError(t, err) {
+			assert.Equal(t, mode, info.Mode().Perm(), file)
+		}
+	}
+}
+
+func TestTarIgnoresFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afs := &afero.Afero{Fs: fs}
+
+	source := "testdata/examples/ignored"
+	files := map[string]bool{
+		".pctignore":                      true,
+		"pct-config.yml":                  true,
+		"content/init.pp.tmpl":            true,
+		"content/.DS_Store":               false,
+		"content/init.pp.tmpl.swp":        false,
+		"README.md":                       false,
+		"content/README.md.tmpl":          true,
+		"spec/fixtures/modules/stdlib.pp": false,
+	}
+	for file := range files {
+		afs.WriteFile(filepath.Join(source, file), []byte("content"), 0644) //nolint:errcheck
+	}
+	afs.WriteFile(filepath.Join(source, ".pctignore"), []byte("# editor files\n.DS_Store\n*.swp\n/README.md\nspec/\n"), 0644) //nolint:errcheck
+
+	tarDir, _ := afs.TempDir("", "")
+	tr := &tar.Tar{AFS: afs}
+	tarFile, err := tr.Tar(source, tarDir)
+	assert.NoError(t, err)
+
+	untarDir, _ := afs.TempDir("", "")
+	outputDir, err := tr.Untar(tarFile, untarDir)
+	assert.NoError(t, err)
+
+	for file, packaged := range files {
+		exists, _ := afs.Exists(filepath.Join(outputDir, file))
+		assert.Equal(t, packaged, exists, file)
+	}
+	exists, _ := afs.DirExists(filepath.Join(outputDir, "spec"))
+	assert.False(t, exists)
+}
@@ -0,0 +1,522 @@
+/*
+Package template_funcs provides the functions available to Puppet Content
+Templates when they are rendered.
+
+Every function is registered once in Registry together with its usage and a
+description, so the FuncMap handed to text/template and the documentation shown
+by `pct explain template-functions` can never drift apart.
+*/
+package template_funcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Function describes a single template function
+type Function struct {
+	Name        string
+	Usage       string
+	Description string
+	Func        interface{}
+}
+
+// Now returns the current time; it can be replaced to render with a fixed time
+var Now = time.Now
+
+// Registry lists every function available to templates, in the order they are
+// documented
+var Registry = []Function{
+	{
+		Name:        "toClassName",
+		Usage:       `{{ toClassName "my_class" }}`,
+		Description: "Title cases a lower cased string, eg `My_class`.",
+		Func: func(itemName string) string {
+			return strings.Title(strings.ToLower(itemName))
+		},
+	},
+	{
+		Name:        "snake",
+		Usage:       `{{ "MyModule name" | snake }}`,
+		Description: "Converts a string to snake case, eg `my_module_name`.",
+		Func: func(s string) string {
+			return strings.ToLower(strings.Join(words(s), "_"))
+		},
+	},
+	{
+		Name:        "kebab",
+		Usage:       `{{ "MyModule name" | kebab }}`,
+		Description: "Converts a string to kebab case, eg `my-module-name`.",
+		Func: func(s string) string {
+			return strings.ToLower(strings.Join(words(s), "-"))
+		},
+	},
+	{
+		Name:        "camel",
+		Usage:       `{{ "my-module name" | camel }}`,
+		Description: "Converts a string to camel case, eg `myModuleName`.",
+		Func:        camel,
+	},
+	{
+		Name:        "pascal",
+		Usage:       `{{ "my-module name" | pascal }}`,
+		Description: "Converts a string to pascal case, eg `MyModuleName`.",
+		Func: func(s string) string {
+			var b strings.Builder
+			for _, w := range words(s) {
+				b.WriteString(capitalise(w))
+			}
+			return b.String()
+		},
+	},
+	{
+		Name:        "puppetName",
+		Usage:       `{{ "Acme-NTP::Server Config" | puppetName }}`,
+		Description: "Converts a string into a valid Puppet class, defined type or parameter name, keeping `::` namespaces, eg `acme_ntp::server_config`.",
+		Func:        puppetName,
+	},
+	{
+		Name:        "lower",
+		Usage:       `{{ .name | lower }}`,
+		Description: "Converts a string to lower case.",
+		Func:        strings.ToLower,
+	},
+	{
+		Name:        "upper",
+		Usage:       `{{ .name | upper }}`,
+		Description: "Converts a string to upper case.",
+		Func:        strings.ToUpper,
+	},
+	{
+		Name:        "trim",
+		Usage:       `{{ .name | trim }}`,
+		Description: "Removes leading and trailing white space.",
+		Func:        strings.TrimSpace,
+	},
+	{
+		Name:        "replace",
+		Usage:       `{{ .name | replace "-" "_" }}`,
+		Description: "Replaces every occurrence of a string with another.",
+		Func: func(old, new, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+	},
+	{
+		Name:        "regexReplace",
+		Usage:       `{{ .name | regexReplace "[^a-z]+" "_" }}`,
+		Description: "Replaces every match of a regular expression; the replacement can refer to groups as `$1`.",
+		Func: func(expr, replacement, s string) (string, error) {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return "", err
+			}
+			return re.ReplaceAllString(s, replacement), nil
+		},
+	},
+	{
+		Name:        "quote",
+		Usage:       `{{ .description | quote }}`,
+		Description: "Wraps a value in double quotes, escaping any it contains.",
+		Func: func(v interface{}) string {
+			return fmt.Sprintf("%q", fmt.Sprint(v))
+		},
+	},
+	{
+		Name:        "squote",
+		Usage:       `{{ .description | squote }}`,
+		Description: "Wraps a value in single quotes, escaping any it contains as Puppet and YAML expect.",
+		Func: func(v interface{}) string {
+			return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+		},
+	},
+	{
+		Name:        "shellquote",
+		Usage:       `{{ .path | shellquote }}`,
+		Description: "Quotes a value as a single argument to a POSIX shell command. Values in hook commands are quoted like this automatically.",
+		Func: func(v interface{}) string {
+			return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", `'\''`) + "'"
+		},
+	},
+	{
+		Name:        "default",
+		Usage:       `{{ .license | default "Apache-2.0" }}`,
+		Description: "Returns the value, or the default when the value is missing or empty.",
+		Func: func(def interface{}, v ...interface{}) interface{} {
+			if len(v) == 0 || empty(v[0]) {
+				return def
+			}
+			return v[0]
+		},
+	},
+	{
+		Name:        "required",
+		Usage:       `{{ .author | required "an author is required" }}`,
+		Description: "Returns the value, or fails rendering with the message when the value is missing or empty.",
+		Func: func(message string, v ...interface{}) (interface{}, error) {
+			if len(v) == 0 || empty(v[0]) {
+				return nil, fmt.Errorf("%s", message)
+			}
+			return v[0], nil
+		},
+	},
+	{
+		Name:        "get",
+		Usage:       `{{ get . "puppet_module" "license" }}`,
+		Description: "Returns the value at a path of keys within a dictionary, or nothing when it is missing, even in strict mode. Values given to `default` and `required` are looked up like this automatically.",
+		Func: func(dict interface{}, keys ...string) interface{} {
+			value := reflect.ValueOf(dict)
+			for _, key := range keys {
+				for value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr {
+					if value.IsNil() {
+						return nil
+					}
+					value = value.Elem()
+				}
+				switch value.Kind() {
+				case reflect.Map:
+					k := reflect.ValueOf(key)
+					if !k.Type().AssignableTo(value.Type().Key()) {
+						return nil
+					}
+					value = value.MapIndex(k)
+				case reflect.Struct:
+					value = value.FieldByName(key)
+				default:
+					return nil
+				}
+				if !value.IsValid() {
+					return nil
+				}
+			}
+			if !value.IsValid() || !value.CanInterface() {
+				return nil
+			}
+			return value.Interface()
+		},
+	},
+	{
+		Name:        "toYaml",
+		Usage:       `{{ .settings | toYaml }}`,
+		Description: "Serialises a value as YAML, without a trailing new line.",
+		Func: func(v interface{}) (string, error) {
+			out, err := yaml.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(string(out), "\n"), nil
+		},
+	},
+	{
+		Name:        "toJson",
+		Usage:       `{{ .settings | toJson }}`,
+		Description: "Serialises a value as compact JSON.",
+		Func: func(v interface{}) (string, error) {
+			out, err := json.Marshal(jsonCompatible(v))
+			if err != nil {
+				return "", err
+			}
+			return string(out), nil
+		},
+	},
+	{
+		Name:        "indent",
+		Usage:       `{{ .settings | toYaml | indent 4 }}`,
+		Description: "Indents every line of a string by a number of spaces.",
+		Func:        indent,
+	},
+	{
+		Name:        "nindent",
+		Usage:       `{{- .settings | toYaml | nindent 4 }}`,
+		Description: "Like `indent`, but starts with a new line.",
+		Func: func(spaces int, s string) string {
+			return "\n" + indent(spaces, s)
+		},
+	},
+	{
+		Name:        "now",
+		Usage:       `{{ now.Format "2006-01-02" }}`,
+		Description: "Returns the current time.",
+		Func: func() time.Time {
+			return Now()
+		},
+	},
+	{
+		Name:        "year",
+		Usage:       `Copyright {{ year }}`,
+		Description: "Returns the current year, eg for license headers.",
+		Func: func() int {
+			return Now().Year()
+		},
+	},
+	{
+		Name:        "list",
+		Usage:       `{{ list "a" "b" "c" }}`,
+		Description: "Creates a list from its arguments.",
+		Func: func(v ...interface{}) []interface{} {
+			return v
+		},
+	},
+	{
+		Name:        "has",
+		Usage:       `{{ if has "RedHat" .platforms }}`,
+		Description: "Reports whether a list contains a value.",
+		Func: func(needle interface{}, list interface{}) bool {
+			for _, v := range toList(list) {
+				if reflect.DeepEqual(v, needle) {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		Name:        "join",
+		Usage:       `{{ .platforms | join ", " }}`,
+		Description: "Joins the items of a list with a separator.",
+		Func: func(sep string, list interface{}) string {
+			var items []string
+			for _, v := range toList(list) {
+				items = append(items, fmt.Sprint(v))
+			}
+			return strings.Join(items, sep)
+		},
+	},
+	{
+		Name:        "first",
+		Usage:       `{{ .platforms | first }}`,
+		Description: "Returns the first item of a list, or nothing when it is empty.",
+		Func: func(list interface{}) interface{} {
+			items := toList(list)
+			if len(items) == 0 {
+				return nil
+			}
+			return items[0]
+		},
+	},
+	{
+		Name:        "last",
+		Usage:       `{{ .platforms | last }}`,
+		Description: "Returns the last item of a list, or nothing when it is empty.",
+		Func: func(list interface{}) interface{} {
+			items := toList(list)
+			if len(items) == 0 {
+				return nil
+			}
+			return items[len(items)-1]
+		},
+	},
+	{
+		Name:        "dict",
+		Usage:       `{{ dict "name" .pct_name "ensure" "present" }}`,
+		Description: "Creates a dictionary from alternating keys and values.",
+		Func: func(v ...interface{}) (map[string]interface{}, error) {
+			if len(v)%2 != 0 {
+				return nil, fmt.Errorf("dict requires an even number of arguments")
+			}
+			d := make(map[string]interface{}, len(v)/2)
+			for i := 0; i < len(v); i += 2 {
+				d[fmt.Sprint(v[i])] = v[i+1]
+			}
+			return d, nil
+		},
+	},
+	{
+		Name:        "keys",
+		Usage:       `{{ range keys .settings }}`,
+		Description: "Returns the keys of a dictionary in sorted order.",
+		Func: func(dict interface{}) []string {
+			var keys []string
+			value := reflect.ValueOf(dict)
+			if value.Kind() != reflect.Map {
+				return keys
+			}
+			for _, k := range value.MapKeys() {
+				keys = append(keys, fmt.Sprint(k.Interface()))
+			}
+			sort.Strings(keys)
+			return keys
+		},
+	},
+	{
+		Name:        "hasKey",
+		Usage:       `{{ if hasKey .settings "port" }}`,
+		Description: "Reports whether a dictionary contains a key.",
+		Func: func(dict interface{}, key string) bool {
+			value := reflect.ValueOf(dict)
+			if value.Kind() != reflect.Map {
+				return false
+			}
+			for _, k := range value.MapKeys() {
+				if fmt.Sprint(k.Interface()) == key {
+					return true
+				}
+			}
+			return false
+		},
+	},
+}
+
+// FuncMap returns every registered function keyed by name, ready to pass to
+// template.Funcs
+func FuncMap() template.FuncMap {
+	funcs := make(template.FuncMap, len(Registry))
+	for _, f := range Registry {
+		funcs[f.Name] = f.Func
+	}
+	return funcs
+}
+
+// Markdown documents every registered function as a markdown table
+func Markdown() string {
+	var b strings.Builder
+	b.WriteString("Templates can call the following functions in addition to those built in to ")
+	b.WriteString("[Go's templating language](https://golang.org/pkg/text/template/#hdr-Functions).\n\n")
+	b.WriteString("| Function | Usage | Description |\n")
+	b.WriteString("| -------- | ----- | ----------- |\n")
+	for _, f := range Registry {
+		b.WriteString(fmt.Sprintf("| %s | `%s` | %s |\n", f.Name, strings.ReplaceAll(f.Usage, "|", "\\|"), f.Description))
+	}
+	return b.String()
+}
+
+// words splits a string into words on separators and changes of case, keeping
+// acronyms together, so "HTTPServer_config" becomes HTTP, Server and config
+func words(s string) []string {
+	var result []string
+	var current []rune
+	runes := []rune(s)
+
+	flush := func() {
+		if len(current) > 0 {
+			result = append(result, string(current))
+			current = nil
+		}
+	}
+
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := current[len(current)-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+
+	return result
+}
+
+func capitalise(word string) string {
+	runes := []rune(strings.ToLower(word))
+	if len(runes) == 0 {
+		return ""
+	}
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func camel(s string) string {
+	var b strings.Builder
+	for i, w := range words(s) {
+		if i == 0 {
+			b.WriteString(strings.ToLower(w))
+		} else {
+			b.WriteString(capitalise(w))
+		}
+	}
+	return b.String()
+}
+
+var puppetNameInvalid = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// puppetName converts each "::" separated segment of a string into a lower
+// case name that starts with a letter, as Puppet requires of class, defined
+// type and parameter names
+func puppetName(s string) string {
+	var segments []string
+	for _, segment := range strings.Split(s, "::") {
+		segment = strings.ToLower(strings.Join(words(segment), "_"))
+		segment = strings.Trim(puppetNameInvalid.ReplaceAllString(segment, "_"), "_")
+		if segment == "" {
+			continue
+		}
+		if segment[0] < 'a' || segment[0] > 'z' {
+			segment = "a" + segment
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "::")
+}
+
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// empty reports whether a value is missing, zero or has no items
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return value.IsZero()
+}
+
+func toList(list interface{}) []interface{} {
+	value := reflect.ValueOf(list)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil
+	}
+	items := make([]interface{}, value.Len())
+	for i := range items {
+		items[i] = value.Index(i).Interface()
+	}
+	return items
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values produced by
+// YAML parsing into maps that encoding/json can serialise
+func jsonCompatible(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = jsonCompatible(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = jsonCompatible(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, val := range t {
+			l[i] = jsonCompatible(val)
+		}
+		return l
+	}
+	return v
+}
@@ -0,0 +1,99 @@
+package template_funcs_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/puppetlabs/pct/pkg/template_funcs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuncMap(t *testing.T) {
+	template_funcs.Now = func() time.Time { return time.Date(2022, time.March, 4, 10, 0, 0, 0, time.UTC) }
+	defer func() { template_funcs.Now = time.Now }()
+
+	vars := map[string]interface{}{
+		"name":        "My-Module name",
+		"empty":       "",
+		"platforms":   []interface{}{"RedHat", "Debian"},
+		"settings":    map[string]interface{}{"port": 8080, "hosts": []interface{}{"a", "b"}},
+		"yamlish":     map[interface{}]interface{}{"nested": map[interface{}]interface{}{"key": "value"}},
+		"description": `say "hi" it's`,
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{name: "toClassName", template: `{{ toClassName "MY_class" }}`, want: "My_class"},
+		{name: "snake", template: `{{ .name | snake }}`, want: "my_module_name"},
+		{name: "snake splits acronyms", template: `{{ "HTTPServerConfig2go" | snake }}`, want: "http_server_config2go"},
+		{name: "kebab", template: `{{ "myModule_name" | kebab }}`, want: "my-module-name"},
+		{name: "camel", template: `{{ .name | camel }}`, want: "myModuleName"},
+		{name: "pascal", template: `{{ "my-module name" | pascal }}`, want: "MyModuleName"},
+		{name: "puppetName", template: `{{ "Acme-NTP::Server Config" | puppetName }}`, want: "acme_ntp::server_config"},
+		{name: "puppetName must start with a letter", template: `{{ "2fa" | puppetName }}`, want: "a2fa"},
+		{name: "lower", template: `{{ "ABC" | lower }}`, want: "abc"},
+		{name: "upper", template: `{{ "abc" | upper }}`, want: "ABC"},
+		{name: "trim", template: `{{ "  abc " | trim }}`, want: "abc"},
+		{name: "replace", template: `{{ "a-b-c" | replace "-" "_" }}`, want: "a_b_c"},
+		{name: "regexReplace", template: `{{ "foo123bar" | regexReplace "([a-z]+)[0-9]+" "${1}_" }}`, want: "foo_bar"},
+		{name: "regexReplace with an invalid expression", template: `{{ "foo" | regexReplace "(" "" }}`, wantErr: "missing closing )"},
+		{name: "quote", template: `{{ .description | quote }}`, want: `"say \"hi\" it's"`},
+		{name: "squote", template: `{{ .description | squote }}`, want: `'say "hi" it''s'`},
+		{name: "shellquote", template: `{{ .description | shellquote }}`, want: `'say "hi" it'\''s'`},
+		{name: "default for a missing value", template: `{{ .missing | default "Apache-2.0" }}`, want: "Apache-2.0"},
+		{name: "default for an empty value", template: `{{ .empty | default "Apache-2.0" }}`, want: "Apache-2.0"},
+		{name: "default keeps a value", template: `{{ .name | default "other" }}`, want: "My-Module name"},
+		{name: "required keeps a value", template: `{{ .name | required "a name is required" }}`, want: "My-Module name"},
+		{name: "required fails for a missing value", template: `{{ .missing | required "a name is required" }}`, wantErr: "a name is required"},
+		{name: "get", template: `{{ get . "settings" "port" }} {{ get . "yamlish" "nested" "key" }}`, want: "8080 value"},
+		{name: "get a missing value", template: `{{ get . "missing" "key" | default "none" }}`, want: "none"},
+		{name: "toYaml", template: `{{ .platforms | toYaml }}`, want: "- RedHat\n- Debian"},
+		{name: "toJson", template: `{{ .settings | toJson }}`, want: `{"hosts":["a","b"],"port":8080}`},
+		{name: "toJson with yaml maps", template: `{{ .yamlish | toJson }}`, want: `{"nested":{"key":"value"}}`},
+		{name: "indent", template: `{{ .platforms | toYaml | indent 2 }}`, want: "  - RedHat\n  - Debian"},
+		{name: "nindent", template: `key:{{ .platforms | toYaml | nindent 2 }}`, want: "key:\n  - RedHat\n  - Debian"},
+		{name: "now", template: `{{ now.Format "2006-01-02" }}`, want: "2022-03-04"},
+		{name: "year", template: `Copyright {{ year }}`, want: "Copyright 2022"},
+		{name: "list", template: `{{ list "a" "b" | join "," }}`, want: "a,b"},
+		{name: "has", template: `{{ has "Debian" .platforms }} {{ has "Windows" .platforms }}`, want: "true false"},
+		{name: "join", template: `{{ .platforms | join ", " }}`, want: "RedHat, Debian"},
+		{name: "first and last", template: `{{ .platforms | first }} {{ .platforms | last }}`, want: "RedHat Debian"},
+		{name: "dict", template: `{{ (dict "ensure" "present").ensure }}`, want: "present"},
+		{name: "dict with an odd number of arguments", template: `{{ dict "ensure" }}`, wantErr: "even number of arguments"},
+		{name: "keys", template: `{{ keys .settings | join "," }}`, want: "hosts,port"},
+		{name: "hasKey", template: `{{ hasKey .settings "port" }} {{ hasKey .settings "missing" }}`, want: "true false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New(tt.name).Funcs(template_funcs.FuncMap()).Parse(tt.template)
+			assert.NoError(t, err)
+
+			var out bytes.Buffer
+			err = tmpl.Execute(&out, vars)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	doc := template_funcs.Markdown()
+	for _, f := range template_funcs.Registry {
+		assert.Contains(t, doc, "| "+f.Name+" |")
+		assert.NotEmpty(t, f.Description, f.Name)
+		assert.True(t, strings.Contains(f.Usage, f.Name), "usage of %s should show the function", f.Name)
+	}
+}
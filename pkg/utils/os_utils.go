@@ -9,6 +9,7 @@ type OsUtilI interface {
 	Hostname() (name string, err error)
 	WriteString(w io.Writer, s string) (n int, err error)
 	Getwd() (dir string, err error)
+	Environ() []string
 }
 
 type OsUtil struct{}
@@ -24,3 +25,7 @@ func (*OsUtil) WriteString(w io.Writer, s string) (n int, err error) {
 func (*OsUtil) Getwd() (dir string, err error) {
 	return os.Getwd()
 }
+
+func (*OsUtil) Environ() []string {
+	return os.Environ()
+}
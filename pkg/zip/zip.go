@@ -0,0 +1,67 @@
+package zip
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/puppetlabs/pct/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/afero"
+)
+
+type Zip struct {
+	AFS *afero.Afero
+}
+
+// Write streams the contents of a directory to w as a zip archive, with each
+// entry named relative to the directory. File modes are kept.
+func (z *Zip) Write(w io.Writer, source string) error {
+	archive := zip.NewWriter(w)
+
+	err := z.AFS.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		writer, err := archive.CreateHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		file, err := z.AFS.Open(filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := file.Close(); err != nil {
+				log.Error().Msgf("Error closing file: %s\n", err)
+			}
+		}()
+
+		return utils.ChunkedCopy(writer, file)
+	})
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
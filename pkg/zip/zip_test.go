@@ -0,0 +1,59 @@
+package zip_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pctzip "github.com/puppetlabs/pct/pkg/zip"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afs := &afero.Afero{Fs: fs}
+
+	source := "output/module"
+	files := map[string]os.FileMode{
+		"README.md":            0644,
+		"scripts/bootstrap.sh": 0755,
+		"manifests/init.pp":    0640,
+	}
+	for file, mode := range files {
+		afs.WriteFile(filepath.Join(source, file), []byte(file), mode) //nolint:errcheck
+		afs.Chmod(filepath.Join(source, file), mode)                   //nolint:errcheck
+	}
+
+	var out bytes.Buffer
+	err := (&pctzip.Zip{AFS: afs}).Write(&out, source)
+	assert.NoError(t, err)
+
+	reader, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	assert.NoError(t, err)
+
+	found := make(map[string]bool)
+	for _, f := range reader.File {
+		found[f.Name] = true
+		mode, isFile := files[f.Name]
+		if !isFile {
+			continue
+		}
+		assert.Equal(t, mode, f.Mode().Perm(), f.Name)
+		rc, err := f.Open()
+		if assert.NoError(t, err) {
+			content, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			assert.Equal(t, f.Name, string(content))
+		}
+	}
+	assert.Equal(t, map[string]bool{
+		"README.md": true, "scripts/": true, "scripts/bootstrap.sh": true, "manifests/": true, "manifests/init.pp": true,
+	}, found)
+
+	err = (&pctzip.Zip{AFS: afs}).Write(&out, "missing")
+	assert.Error(t, err)
+}